@@ -3,23 +3,32 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ncecere/mapper/pkg/crawler"
+	"github.com/ncecere/mapper/pkg/scope"
 	"github.com/ncecere/mapper/pkg/sitemap"
 	"github.com/ncecere/mapper/pkg/ui"
+	"github.com/ncecere/mapper/pkg/urlnorm"
+	"github.com/ncecere/mapper/pkg/urlpattern"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 var generateCmd = &cobra.Command{
 	Use:   "generate [url]",
 	Short: "Generate a sitemap for the specified URL",
 	Long: `Generate an XML sitemap by crawling the specified website.
-The crawler stays within the same domain as the provided URL.
+The crawler stays on the host of the provided URL, unless a wider
+scope, host aliases or additional hosts are configured.
 
 Example:
   mapper generate https://example.com
@@ -33,13 +42,67 @@ func init() {
 
 	// Local flags
 	generateCmd.Flags().IntP("depth", "d", 3, "maximum crawl depth")
+	generateCmd.Flags().Int("max-pages", 0, "stop after fetching this many pages (0 for no limit)")
+	generateCmd.Flags().Duration("max-duration", 0, "stop crawling after this long, e.g. 30m (0 for no limit)")
+	generateCmd.Flags().String("max-bytes", "0", "stop after downloading this much page content, e.g. 500MB (0 for no limit)")
 	generateCmd.Flags().StringP("output", "o", "sitemap.xml", "output file path")
 	generateCmd.Flags().IntP("concurrent", "c", 5, "maximum concurrent requests")
 	generateCmd.Flags().DurationP("timeout", "t", 10*time.Second, "request timeout")
-	generateCmd.Flags().DurationP("rate-limit", "r", time.Second, "rate limit between requests")
-	generateCmd.Flags().StringSliceP("exclude", "e", []string{}, "paths to exclude (e.g., /admin/*)")
+	generateCmd.Flags().DurationP("rate-limit", "r", time.Second, "minimum time between requests to a host, shared by all workers")
+	generateCmd.Flags().Int("burst", 1, "number of requests to a host allowed back to back")
+	generateCmd.Flags().Bool("adaptive-rate", false, "slow down when the server responds slowly or with 429/503, and speed back up when healthy")
+	generateCmd.Flags().String("max-body-size", "10MB", "maximum size of a page body; longer pages are truncated (0 for no limit)")
+	generateCmd.Flags().StringSlice("skip-extensions", []string{}, "additional file extensions not to crawl, e.g. .json,.rss")
+	generateCmd.Flags().StringSlice("crawl-extensions", []string{}, "file extensions to remove from the default skip list, e.g. .svg")
+	generateCmd.Flags().StringSlice("list-extensions", []string{}, "file extensions to list without parsing, e.g. .pdf,.docx")
+	generateCmd.Flags().Bool("head-sniff", false, "check the content type of URLs without a file extension with a HEAD request before downloading them")
+	generateCmd.Flags().StringSlice("list-content-types", []string{}, "non-HTML content types to list without parsing, e.g. application/pdf,image/*")
+	generateCmd.Flags().Int("retries", 2, "number of retries for network errors and 429/5xx responses")
+	generateCmd.Flags().Duration("retry-max-wait", 30*time.Second, "maximum wait between retries, including Retry-After delays")
+	generateCmd.Flags().String("scope", scope.ModeHost, "crawl scope: host (the URL's host only) or domain (the registrable domain and all its subdomains)")
+	generateCmd.Flags().StringSlice("host-alias", []string{}, "hosts serving the same site as the URL's host, e.g. www.example.com; their URLs are listed under the URL's host")
+	generateCmd.Flags().StringSlice("allow-host", []string{}, "additional hosts to crawl, e.g. blog.example.com or *.example.com")
+	generateCmd.Flags().Bool("per-host-sitemaps", false, "write one sitemap per host into <output dir>/<host>/ instead of a combined sitemap")
+	generateCmd.Flags().StringSlice("scope-prefix", []string{}, "only list URLs under these path prefixes; without a value, under the start URL's path (e.g., --scope-prefix=/docs/,/api/)")
+	generateCmd.Flags().Lookup("scope-prefix").NoOptDefVal = "."
+	generateCmd.Flags().StringSlice("pass-through", []string{}, "paths outside --scope-prefix to crawl for links without listing them (e.g., /,/sections/*)")
+	generateCmd.Flags().StringArrayP("exclude", "e", []string{}, "URLs to exclude: path globs (e.g., /admin/**, **/*.pdf) or full-URL regexes prefixed with re:")
+	generateCmd.Flags().StringArrayP("include", "i", []string{}, "only crawl URLs matching these patterns, in the same syntax as --exclude")
+	generateCmd.Flags().String("exclude-from", "", "file with exclude patterns, one per line")
+	generateCmd.Flags().String("include-from", "", "file with include patterns, one per line")
 	generateCmd.Flags().Bool("no-follow-redirects", false, "don't follow redirects")
 	generateCmd.Flags().Bool("strip-query", true, "strip query parameters from URLs")
+	generateCmd.Flags().String("trailing-slash", urlnorm.TrailingSlashKeep, "trailing slash policy for URLs: keep, add or remove")
+	generateCmd.Flags().Bool("sort-query", true, "sort query parameters so their order doesn't create duplicate URLs")
+	generateCmd.Flags().Bool("strip-tracking", true, "strip tracking query parameters such as utm_* and gclid")
+	generateCmd.Flags().StringSlice("keep-query-params", []string{}, "only keep these query parameters, e.g. id,page (disables --strip-query unless set)")
+	generateCmd.Flags().StringSlice("drop-query-params", []string{}, "drop these query parameters, e.g. sort,filter_* (disables --strip-query unless set)")
+	generateCmd.Flags().Bool("fold-index", false, "treat directory index files such as /docs/index.html as /docs/")
+	generateCmd.Flags().Bool("ignore-robots", false, "ignore robots.txt rules and Crawl-delay")
+	generateCmd.Flags().String("cache-file", "", "crawl cache for conditional requests and lastmod tracking; unchanged pages are not downloaded again on the next run")
+	generateCmd.Flags().StringSlice("lastmod-sources", crawler.DefaultLastModSources, "sources of lastmod dates in order of precedence: meta, jsonld, header and time")
+	generateCmd.Flags().Bool("strip-boilerplate", false, "leave boilerplate elements out of the content hash used for lastmod tracking")
+	generateCmd.Flags().StringSlice("boilerplate-selectors", crawler.DefaultBoilerplateSelectors, "boilerplate elements for --strip-boilerplate: element names, .class or #id")
+	generateCmd.Flags().Bool("seed-sitemaps", false, "seed the crawl from the site's existing sitemaps and robots.txt Sitemap directives")
+	generateCmd.Flags().String("state-file", "", "crawl state file for checkpoints (default is <output>.state.json)")
+	generateCmd.Flags().Duration("checkpoint-interval", 30*time.Second, "interval between crawl checkpoints (0 disables periodic checkpoints)")
+	generateCmd.Flags().Bool("resume", false, "resume an interrupted crawl from the state file")
+	generateCmd.Flags().Bool("gzip", false, "gzip-compress the sitemap (implied by a .gz output file)")
+	generateCmd.Flags().Bool("ignore-nofollow", false, "follow rel=\"nofollow\" links and links on nofollow pages")
+	generateCmd.Flags().Bool("images", false, "list the images of each page using the image sitemap extension")
+	generateCmd.Flags().Int("max-images-per-page", sitemap.MaxImagesPerURL, "maximum number of images listed per page")
+	generateCmd.Flags().Bool("auto-priority", false, "derive priorities from crawl depth and inbound link count; sitemap_rules in the config file take precedence")
+	generateCmd.Flags().String("sitemap-base-url", "", "base URL for sitemap locations in a sitemap index (default is the site root)")
+
+	// Bind flags that may also be set in the config file
+	viper.BindPFlag("skip_extensions", generateCmd.Flags().Lookup("skip-extensions"))
+	viper.BindPFlag("crawl_extensions", generateCmd.Flags().Lookup("crawl-extensions"))
+	viper.BindPFlag("list_extensions", generateCmd.Flags().Lookup("list-extensions"))
+	viper.BindPFlag("head_sniff", generateCmd.Flags().Lookup("head-sniff"))
+	viper.BindPFlag("auto_priority", generateCmd.Flags().Lookup("auto-priority"))
+	viper.BindPFlag("lastmod_sources", generateCmd.Flags().Lookup("lastmod-sources"))
+	viper.BindPFlag("strip_boilerplate", generateCmd.Flags().Lookup("strip-boilerplate"))
+	viper.BindPFlag("boilerplate_selectors", generateCmd.Flags().Lookup("boilerplate-selectors"))
 }
 
 func runGenerate(cmd *cobra.Command, args []string) error {
@@ -51,13 +114,142 @@ func runGenerate(cmd *cobra.Command, args []string) error {
 
 	// Get flags
 	depth, _ := cmd.Flags().GetInt("depth")
+	maxPages, _ := cmd.Flags().GetInt("max-pages")
+	maxDuration, _ := cmd.Flags().GetDuration("max-duration")
+	maxBytesFlag, _ := cmd.Flags().GetString("max-bytes")
 	outputPath, _ := cmd.Flags().GetString("output")
 	concurrent, _ := cmd.Flags().GetInt("concurrent")
 	timeout, _ := cmd.Flags().GetDuration("timeout")
 	rateLimit, _ := cmd.Flags().GetDuration("rate-limit")
-	excludePaths, _ := cmd.Flags().GetStringSlice("exclude")
+	burst, _ := cmd.Flags().GetInt("burst")
+	adaptiveRate, _ := cmd.Flags().GetBool("adaptive-rate")
+	maxBodySizeFlag, _ := cmd.Flags().GetString("max-body-size")
+	listContentTypes, _ := cmd.Flags().GetStringSlice("list-content-types")
+	skipExtensions := GetSkipExtensions()
+	crawlExtensions := GetCrawlExtensions()
+	listExtensions := GetListExtensions()
+	headSniff := GetHeadSniff()
+	retries, _ := cmd.Flags().GetInt("retries")
+	retryMaxWait, _ := cmd.Flags().GetDuration("retry-max-wait")
+	scopeMode, _ := cmd.Flags().GetString("scope")
+	hostAliases, _ := cmd.Flags().GetStringSlice("host-alias")
+	allowHosts, _ := cmd.Flags().GetStringSlice("allow-host")
+	perHost, _ := cmd.Flags().GetBool("per-host-sitemaps")
+	scopePrefixes, _ := cmd.Flags().GetStringSlice("scope-prefix")
+	passThrough, _ := cmd.Flags().GetStringSlice("pass-through")
+	excludePatterns, _ := cmd.Flags().GetStringArray("exclude")
+	includePatterns, _ := cmd.Flags().GetStringArray("include")
+	excludeFrom, _ := cmd.Flags().GetString("exclude-from")
+	includeFrom, _ := cmd.Flags().GetString("include-from")
 	noFollowRedirects, _ := cmd.Flags().GetBool("no-follow-redirects")
 	stripQuery, _ := cmd.Flags().GetBool("strip-query")
+	trailingSlash, _ := cmd.Flags().GetString("trailing-slash")
+	sortQuery, _ := cmd.Flags().GetBool("sort-query")
+	stripTracking, _ := cmd.Flags().GetBool("strip-tracking")
+	foldIndex, _ := cmd.Flags().GetBool("fold-index")
+	keepParams, _ := cmd.Flags().GetStringSlice("keep-query-params")
+	dropParams, _ := cmd.Flags().GetStringSlice("drop-query-params")
+	ignoreRobots, _ := cmd.Flags().GetBool("ignore-robots")
+	sitemapBaseURL, _ := cmd.Flags().GetString("sitemap-base-url")
+	gzipOutput, _ := cmd.Flags().GetBool("gzip")
+	stateFile, _ := cmd.Flags().GetString("state-file")
+	checkpointInterval, _ := cmd.Flags().GetDuration("checkpoint-interval")
+	resume, _ := cmd.Flags().GetBool("resume")
+	seedSitemaps, _ := cmd.Flags().GetBool("seed-sitemaps")
+	cacheFile, _ := cmd.Flags().GetString("cache-file")
+	lastModSources := GetLastModSources()
+	autoPriority := GetAutoPriority()
+	images, _ := cmd.Flags().GetBool("images")
+	maxImages, _ := cmd.Flags().GetInt("max-images-per-page")
+	stripBoilerplate := GetStripBoilerplate()
+	boilerplateSelectors := GetBoilerplateSelectors()
+	ignoreNoFollow, _ := cmd.Flags().GetBool("ignore-nofollow")
+
+	switch trailingSlash {
+	case urlnorm.TrailingSlashKeep, urlnorm.TrailingSlashAdd, urlnorm.TrailingSlashRemove:
+	default:
+		return fmt.Errorf("invalid trailing slash policy %q: must be keep, add or remove", trailingSlash)
+	}
+
+	// Build the URL normalizer shared by the crawler and the sitemap builder
+	normOpts := urlnorm.DefaultOptions()
+	normOpts.TrailingSlash = trailingSlash
+	normOpts.SortQuery = sortQuery
+	normOpts.StripTracking = stripTracking
+	normOpts.FoldIndex = foldIndex
+	normOpts.KeepParams = keepParams
+	normOpts.DropParams = dropParams
+	normalizer := urlnorm.NewFromOptions(normOpts)
+
+	// Build the crawl scope shared by the crawler and the sitemap builder
+	crawlScope, err := scope.New(normalizer.Normalize(baseURL), scopeMode, hostAliases, allowHosts)
+	if err != nil {
+		return err
+	}
+
+	maxBytes, err := parseByteSize(maxBytesFlag)
+	if err != nil {
+		return fmt.Errorf("invalid max bytes: %w", err)
+	}
+
+	maxBodySize, err := parseByteSize(maxBodySizeFlag)
+	if err != nil {
+		return fmt.Errorf("invalid max body size: %w", err)
+	}
+
+	if maxImages < 0 {
+		return fmt.Errorf("max images per page must be non-negative")
+	}
+
+	// Compile the priority and change frequency rules of the config file
+	ruleConfig, err := GetSitemapRules()
+	if err != nil {
+		return err
+	}
+	var rules *sitemap.Rules
+	if len(ruleConfig) > 0 {
+		rules, err = sitemap.NewRules(ruleConfig)
+		if err != nil {
+			return fmt.Errorf("invalid sitemap rules: %w", err)
+		}
+	}
+
+	// Add patterns from files
+	if excludeFrom != "" {
+		patterns, err := urlpattern.LoadFile(excludeFrom)
+		if err != nil {
+			return fmt.Errorf("failed to load exclude patterns: %w", err)
+		}
+		excludePatterns = append(excludePatterns, patterns...)
+	}
+	if includeFrom != "" {
+		patterns, err := urlpattern.LoadFile(includeFrom)
+		if err != nil {
+			return fmt.Errorf("failed to load include patterns: %w", err)
+		}
+		includePatterns = append(includePatterns, patterns...)
+	}
+
+	// A prefix of "." stands for the start URL's path
+	for i, prefix := range scopePrefixes {
+		if prefix == "." {
+			scopePrefixes[i] = startPathPrefix(baseURL)
+		}
+	}
+
+	if perHost && sitemapBaseURL != "" {
+		return fmt.Errorf("--sitemap-base-url cannot be used with --per-host-sitemaps")
+	}
+
+	// Query parameter lists replace all-or-nothing stripping, so the
+	// parameters they let through are listed in the sitemap
+	if (len(keepParams) > 0 || len(dropParams) > 0) && !cmd.Flags().Changed("strip-query") {
+		stripQuery = false
+	}
+
+	if stateFile == "" {
+		stateFile = outputPath + ".state.json"
+	}
 
 	// Create crawler config
 	config, err := crawler.DefaultConfig(baseURL.String())
@@ -66,12 +258,42 @@ func runGenerate(cmd *cobra.Command, args []string) error {
 	}
 
 	config.MaxDepth = depth
+	config.MaxPages = maxPages
+	config.MaxDuration = maxDuration
+	config.MaxBytes = maxBytes
 	config.MaxConcurrent = concurrent
 	config.RequestTimeout = timeout
 	config.RateLimit = rateLimit
+	config.RateBurst = burst
+	config.AdaptiveRate = adaptiveRate
+	config.MaxBodySize = maxBodySize
+	config.ListContentTypes = listContentTypes
+	config.SkipExtensions = skipList(append(config.SkipExtensions, skipExtensions...), crawlExtensions)
+	config.ListExtensions = listExtensions
+	config.SniffWithHead = headSniff
+	config.MaxRetries = retries
+	config.RetryMaxWait = retryMaxWait
 	config.FollowRedirects = !noFollowRedirects
 	config.UserAgent = GetUserAgent()
-	config.ExcludePatterns = excludePaths
+	config.ExcludePatterns = excludePatterns
+	config.IncludePatterns = includePatterns
+	config.RespectRobots = !ignoreRobots
+	config.StateFile = stateFile
+	config.CheckpointInterval = checkpointInterval
+	config.Resume = resume
+	config.SeedFromSitemaps = seedSitemaps
+	config.CacheFile = cacheFile
+	config.LastModSources = lastModSources
+	if stripBoilerplate {
+		config.BoilerplateSelectors = boilerplateSelectors
+	}
+	config.RespectNoFollow = !ignoreNoFollow
+	config.CollectLinks = autoPriority
+	config.CollectImages = images
+	config.Normalizer = normalizer
+	config.Scope = crawlScope
+	config.ScopePrefixes = scopePrefixes
+	config.PassThrough = passThrough
 
 	// Create crawler
 	c, err := crawler.NewCrawler(config)
@@ -88,11 +310,19 @@ func runGenerate(cmd *cobra.Command, args []string) error {
 	signal.Notify(sigChan, os.Interrupt)
 	go func() {
 		<-sigChan
-		fmt.Println("\nReceived interrupt signal. Shutting down...")
+		fmt.Println("\nReceived interrupt signal. Writing partial sitemap... (press Ctrl-C again to abort)")
 		cancel()
+
+		<-sigChan
+		fmt.Println("\nAborted.")
+		os.Exit(1)
 	}()
 
-	fmt.Printf("Starting crawler for %s\n", baseURL)
+	if resume {
+		fmt.Printf("Resuming crawler for %s from %s\n", baseURL, stateFile)
+	} else {
+		fmt.Printf("Starting crawler for %s\n", baseURL)
+	}
 
 	// Start crawler
 	results, err := c.Start(ctx)
@@ -103,24 +333,84 @@ func runGenerate(cmd *cobra.Command, args []string) error {
 	// Create sitemap builder
 	builderOpts := sitemap.DefaultBuilderOptions()
 	builderOpts.StripQueryParams = stripQuery
+	builderOpts.Normalizer = normalizer
+	builderOpts.Scope = crawlScope
+	builderOpts.Rules = rules
+	builderOpts.AutoPriority = autoPriority
+	builderOpts.MaxImagesPerURL = maxImages
 	builder := sitemap.NewBuilder(baseURL, builderOpts)
 
 	// Create progress tracker
 	progress := ui.NewProgress()
 
 	// Process results
-	var processedCount, errorCount int
+	var processedCount, errorCount, noIndexCount, redirectCount, retriedCount, passThroughCount, unlistedCount, truncatedCount, notModifiedCount int
 	for result := range results {
+		// Redirecting URLs are reported rather than listed
+		if len(result.Redirects) > 0 {
+			redirectCount++
+			if GetDebugMode() {
+				for _, hop := range result.Redirects {
+					fmt.Printf("\nRedirect %d: %s", hop.StatusCode, hop.URL)
+				}
+				fmt.Printf(" -> %s (%d)", result.FinalURL, result.StatusCode)
+			}
+		}
+
+		if result.Attempts > 1 {
+			retriedCount++
+		}
+
+		if result.Truncated {
+			truncatedCount++
+		}
+
+		if result.NotModified {
+			notModifiedCount++
+		}
+
 		if result.Error != nil {
 			errorCount++
 			if GetDebugMode() {
-				fmt.Printf("\nError crawling %s: %v", result.URL, result.Error)
+				fmt.Printf("\nError crawling %s after %d attempts: %v", result.URL, result.Attempts, result.Error)
 			}
 			continue
 		}
 
-		if err := builder.AddURL(result.URL, result.LastMod); err != nil && GetDebugMode() {
-			fmt.Printf("\nError adding URL %s: %v", result.URL, err)
+		// Count inbound links for automatic priorities
+		if result.StatusCode == http.StatusOK || result.NotModified {
+			builder.AddLinks(result.FinalURL, result.Links)
+		}
+
+		// Only final destinations that were successfully fetched are listed;
+		// pages asking not to be indexed are left out of the sitemap
+		switch {
+		case result.StatusCode != http.StatusOK && !result.NotModified:
+			// Unfollowed redirect; the target is crawled separately
+		case result.Unlisted:
+			unlistedCount++
+			if GetDebugMode() {
+				fmt.Printf("\nNot listing %s: %s", result.FinalURL, result.SkipReason)
+			}
+		case result.PassThrough:
+			// Crawled for link discovery only
+			passThroughCount++
+		case result.NoIndex:
+			noIndexCount++
+		default:
+			if err := builder.AddURLAtDepth(result.FinalURL, result.LastMod, result.Depth); err != nil && GetDebugMode() {
+				fmt.Printf("\nError adding URL %s: %v", result.FinalURL, err)
+			}
+			if err := builder.AddImages(result.FinalURL, result.Images); err != nil && GetDebugMode() {
+				fmt.Printf("\nError adding images of %s: %v", result.FinalURL, err)
+			}
+		}
+
+		// Record declared canonicals so only canonical URLs are listed
+		if result.Canonical != "" {
+			if err := builder.SetCanonical(result.FinalURL, result.Canonical); err != nil && GetDebugMode() {
+				fmt.Printf("\nError recording canonical for %s: %v", result.FinalURL, err)
+			}
 		}
 
 		processedCount++
@@ -135,15 +425,30 @@ func runGenerate(cmd *cobra.Command, args []string) error {
 
 	// Wait for crawler to finish
 	c.Wait()
+	budgetReached := c.BudgetReached()
+	if err := c.Err(); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	} else if ctx.Err() != nil || budgetReached != "" {
+		fmt.Printf("Crawl state saved to %s; rerun with --resume to continue\n", stateFile)
+	}
 
-	// Build sitemap
-	urlset, err := builder.Build()
+	// Build the combined sitemap, or one sitemap per host
+	addedCount := builder.Count()
+	var urlsets map[string]*sitemap.URLSet
+	if perHost {
+		urlsets, err = builder.BuildPerHost()
+	} else {
+		var urlset *sitemap.URLSet
+		urlset, err = builder.Build()
+		urlsets = map[string]*sitemap.URLSet{"": urlset}
+	}
 	if err != nil {
 		return fmt.Errorf("failed to build sitemap: %w", err)
 	}
 
 	// Create sitemap writer
 	writer := sitemap.NewWriter(true)
+	writer.SetGzip(gzipOutput)
 
 	// Ensure output directory exists
 	if dir := filepath.Dir(outputPath); dir != "." {
@@ -152,16 +457,162 @@ func runGenerate(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// Write sitemap to file
-	if err := writer.WriteToFile(urlset, outputPath); err != nil {
-		return fmt.Errorf("failed to write sitemap: %w", err)
+	// Resolve the base URL for sitemap index entries
+	indexBaseURL := &url.URL{Scheme: baseURL.Scheme, Host: baseURL.Host, Path: "/"}
+	if sitemapBaseURL != "" {
+		indexBaseURL, err = url.Parse(sitemapBaseURL)
+		if err != nil {
+			return fmt.Errorf("invalid sitemap base URL: %w", err)
+		}
+		if !strings.HasSuffix(indexBaseURL.Path, "/") {
+			indexBaseURL.Path += "/"
+		}
+	}
+
+	// Write sitemaps to file, splitting into a sitemap index if needed.
+	// Per-host sitemaps go into a directory named after the host.
+	hosts := make([]string, 0, len(urlsets))
+	for host := range urlsets {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	var written [][]string
+	listedCount, imageCount := 0, 0
+	for _, host := range hosts {
+		path, base := outputPath, indexBaseURL
+		if host != "" {
+			path = filepath.Join(filepath.Dir(outputPath), strings.ReplaceAll(host, ":", "_"), filepath.Base(outputPath))
+			base = &url.URL{Scheme: indexBaseURL.Scheme, Host: host, Path: "/"}
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return fmt.Errorf("failed to create output directory: %w", err)
+			}
+		}
+
+		files, err := writer.WriteSitemaps(urlsets[host], path, base)
+		if err != nil {
+			return fmt.Errorf("failed to write sitemap: %w", err)
+		}
+		written = append(written, files)
+		listedCount += urlsets[host].Size()
+		for _, entry := range urlsets[host].URLs {
+			imageCount += len(entry.Images)
+		}
 	}
 
 	// Print summary
-	fmt.Printf("\nSitemap generated successfully:\n")
+	switch {
+	case ctx.Err() != nil:
+		fmt.Printf("\nPartial sitemap generated (crawl interrupted):\n")
+	case budgetReached != "":
+		fmt.Printf("\nPartial sitemap generated (%s reached):\n", budgetReached)
+	default:
+		fmt.Printf("\nSitemap generated successfully:\n")
+	}
 	fmt.Printf("- URLs processed: %d\n", processedCount)
 	fmt.Printf("- Errors: %d\n", errorCount)
-	fmt.Printf("- Output file: %s\n", outputPath)
+	if retriedCount > 0 {
+		fmt.Printf("- Retried URLs: %d\n", retriedCount)
+	}
+	if redirectCount > 0 {
+		fmt.Printf("- Redirected URLs: %d\n", redirectCount)
+	}
+	if notModifiedCount > 0 {
+		fmt.Printf("- Unchanged pages (from cache): %d\n", notModifiedCount)
+	}
+	if truncatedCount > 0 {
+		fmt.Printf("- Truncated pages: %d\n", truncatedCount)
+	}
+	if unlistedCount > 0 {
+		fmt.Printf("- Unlisted non-HTML pages: %d\n", unlistedCount)
+	}
+	if passThroughCount > 0 {
+		fmt.Printf("- Pass-through pages (not listed): %d\n", passThroughCount)
+	}
+	if noIndexCount > 0 {
+		fmt.Printf("- Excluded noindex pages: %d\n", noIndexCount)
+	}
+	if images {
+		fmt.Printf("- Images listed: %d\n", imageCount)
+	}
+	if removed := addedCount - listedCount; removed > 0 {
+		fmt.Printf("- Consolidated non-canonical URLs: %d\n", removed)
+	}
+	if issues := builder.CanonicalIssues(); len(issues) > 0 {
+		fmt.Printf("- Canonical issues: %d\n", len(issues))
+		if GetDebugMode() {
+			for _, issue := range issues {
+				fmt.Printf("  %s: %s -> %s\n", issue.Reason, issue.URL, issue.Canonical)
+			}
+		}
+	}
+	for _, files := range written {
+		fmt.Printf("- Output file: %s\n", files[0])
+		if len(files) > 1 {
+			fmt.Printf("- Sitemap index with %d sitemaps: %s\n", len(files)-1, strings.Join(files[1:], ", "))
+		}
+	}
 
 	return nil
 }
+
+// startPathPrefix returns the path prefix of a start URL: its path if it
+// names a directory, otherwise the directory containing it
+func startPathPrefix(u *url.URL) string {
+	p := u.Path
+	if p == "" {
+		return "/"
+	}
+	if last := p[strings.LastIndex(p, "/")+1:]; strings.Contains(last, ".") {
+		return p[:len(p)-len(last)]
+	}
+	return p
+}
+
+// parseByteSize parses a size in bytes, optionally with a KB, MB or GB suffix
+func parseByteSize(size string) (int64, error) {
+	units := []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	}
+
+	value, multiplier := strings.ToUpper(strings.TrimSpace(size)), int64(1)
+	for _, unit := range units {
+		if trimmed, ok := strings.CutSuffix(value, unit.suffix); ok {
+			value, multiplier = strings.TrimSpace(trimmed), unit.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a valid size", size)
+	}
+	return n * multiplier, nil
+}
+
+// skipList returns the skipped extensions without those to be crawled,
+// comparing them case-insensitively and with or without a leading dot
+func skipList(skip, crawl []string) []string {
+	normalize := func(ext string) string {
+		return "." + strings.TrimPrefix(strings.ToLower(strings.TrimSpace(ext)), ".")
+	}
+
+	crawled := make(map[string]bool, len(crawl))
+	for _, ext := range crawl {
+		crawled[normalize(ext)] = true
+	}
+
+	result := make([]string, 0, len(skip))
+	for _, ext := range skip {
+		if !crawled[normalize(ext)] {
+			result = append(result, ext)
+		}
+	}
+	return result
+}
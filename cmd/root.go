@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/ncecere/mapper/pkg/sitemap"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -112,3 +113,52 @@ func GetRequestTimeout() string {
 func GetRateLimit() string {
 	return viper.GetString("rate_limit")
 }
+
+// GetSkipExtensions returns the additional file extensions not to crawl
+func GetSkipExtensions() []string {
+	return viper.GetStringSlice("skip_extensions")
+}
+
+// GetCrawlExtensions returns the file extensions removed from the skip list
+func GetCrawlExtensions() []string {
+	return viper.GetStringSlice("crawl_extensions")
+}
+
+// GetListExtensions returns the file extensions listed without parsing
+func GetListExtensions() []string {
+	return viper.GetStringSlice("list_extensions")
+}
+
+// GetHeadSniff returns whether extension-less URLs are checked with a HEAD request
+func GetHeadSniff() bool {
+	return viper.GetBool("head_sniff")
+}
+
+// GetLastModSources returns the sources of lastmod dates in order of precedence
+func GetLastModSources() []string {
+	return viper.GetStringSlice("lastmod_sources")
+}
+
+// GetStripBoilerplate returns whether boilerplate is left out of content hashes
+func GetStripBoilerplate() bool {
+	return viper.GetBool("strip_boilerplate")
+}
+
+// GetBoilerplateSelectors returns the boilerplate elements left out of content hashes
+func GetBoilerplateSelectors() []string {
+	return viper.GetStringSlice("boilerplate_selectors")
+}
+
+// GetAutoPriority returns whether priorities are derived from depth and inbound links
+func GetAutoPriority() bool {
+	return viper.GetBool("auto_priority")
+}
+
+// GetSitemapRules returns the priority and change frequency rules
+func GetSitemapRules() ([]sitemap.Rule, error) {
+	var rules []sitemap.Rule
+	if err := viper.UnmarshalKey("sitemap_rules", &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse sitemap rules: %w", err)
+	}
+	return rules, nil
+}
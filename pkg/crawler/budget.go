@@ -0,0 +1,92 @@
+package crawler
+
+import (
+	"fmt"
+	"sync"
+)
+
+// budget tracks the resources used by a crawl against its configured limits
+type budget struct {
+	mu sync.Mutex
+
+	// pages is the number of pages fetched or being fetched
+	pages int
+
+	// bytes is the number of response body bytes downloaded
+	bytes int64
+
+	// reached describes the limit that stopped the crawl, if any
+	reached string
+}
+
+// startPage reserves a page from the crawl budget before it is fetched.
+// It returns false if a limit has been reached and the page must not be fetched.
+func (c *Crawler) startPage() bool {
+	c.budget.mu.Lock()
+	defer c.budget.mu.Unlock()
+
+	if c.budget.reached != "" {
+		return false
+	}
+	if c.config.MaxPages > 0 && c.budget.pages >= c.config.MaxPages {
+		c.stopLocked(fmt.Sprintf("page limit of %d", c.config.MaxPages))
+		return false
+	}
+	if c.config.MaxBytes > 0 && c.budget.bytes >= c.config.MaxBytes {
+		c.stopLocked(fmt.Sprintf("byte limit of %d", c.config.MaxBytes))
+		return false
+	}
+
+	// Stop handing out work as soon as the last allowed page has started
+	c.budget.pages++
+	if c.config.MaxPages > 0 && c.budget.pages >= c.config.MaxPages {
+		c.stopLocked(fmt.Sprintf("page limit of %d", c.config.MaxPages))
+	}
+	return true
+}
+
+// finishPage records the bytes downloaded for a fetched page
+func (c *Crawler) finishPage(size int64) {
+	c.budget.mu.Lock()
+	defer c.budget.mu.Unlock()
+
+	c.budget.bytes += size
+	if c.config.MaxBytes > 0 && c.budget.bytes >= c.config.MaxBytes {
+		c.stopLocked(fmt.Sprintf("byte limit of %d", c.config.MaxBytes))
+	}
+}
+
+// stopBudget stops the crawl because the named limit has been reached
+func (c *Crawler) stopBudget(reason string) {
+	c.budget.mu.Lock()
+	defer c.budget.mu.Unlock()
+	c.stopLocked(reason)
+}
+
+// stopLocked records the first limit reached and stops handing out queued
+// URLs; pages being fetched are still completed. The caller must hold
+// c.budget.mu.
+func (c *Crawler) stopLocked(reason string) {
+	if c.budget.reached == "" {
+		c.budget.reached = reason
+		c.queue.Close()
+	}
+}
+
+// settleBudget clears the reached limit if no work was left when the
+// crawl stopped, as the limit then didn't cut the crawl short
+func (c *Crawler) settleBudget() {
+	c.budget.mu.Lock()
+	defer c.budget.mu.Unlock()
+	if c.queue.Len() == 0 && c.queue.InFlight() == 0 {
+		c.budget.reached = ""
+	}
+}
+
+// BudgetReached returns a description of the limit that stopped the crawl,
+// or an empty string if the crawl was not stopped by a limit
+func (c *Crawler) BudgetReached() string {
+	c.budget.mu.Lock()
+	defer c.budget.mu.Unlock()
+	return c.budget.reached
+}
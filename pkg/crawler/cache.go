@@ -0,0 +1,209 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// CacheEntry is the cached state of a crawled URL, used to make conditional
+// requests and to reuse the page's outlinks when it has not changed
+type CacheEntry struct {
+	// ETag is the ETag header of the last response
+	ETag string `json:"etag,omitempty"`
+
+	// LastModified is the Last-Modified header of the last response
+	LastModified string `json:"last_modified,omitempty"`
+
+	// ContentHash is the hash of the page's text content without boilerplate
+	ContentHash string `json:"content_hash,omitempty"`
+
+	// LastMod is the last modification time recorded for the page
+	LastMod time.Time `json:"lastmod"`
+
+	// ContentType is the Content-Type of the last response
+	ContentType string `json:"content_type,omitempty"`
+
+	// Links and NoFollowLinks are the outlinks found on the page
+	Links         []string `json:"links,omitempty"`
+	NoFollowLinks []string `json:"nofollow_links,omitempty"`
+
+	// Images are the image URLs found on the page
+	Images []string `json:"images,omitempty"`
+
+	// NoIndex, NoFollow and Canonical are the page's indexing directives
+	NoIndex   bool   `json:"noindex,omitempty"`
+	NoFollow  bool   `json:"nofollow,omitempty"`
+	Canonical string `json:"canonical,omitempty"`
+
+	// ParseSkipped is the reason the body was not parsed, if it wasn't
+	ParseSkipped string `json:"parse_skipped,omitempty"`
+
+	// CrawledAt is the time the URL was last fetched
+	CrawledAt time.Time `json:"crawled_at"`
+}
+
+// Cache is a persistent crawl cache keyed by URL
+type Cache struct {
+	mu sync.Mutex
+
+	// entries holds the cached state of each URL
+	entries map[string]*CacheEntry
+
+	// visited tracks the URLs fetched during this crawl
+	visited map[string]bool
+}
+
+// LoadCache reads a crawl cache from a file. A missing file yields an empty cache.
+func LoadCache(filename string) (*Cache, error) {
+	cache := &Cache{
+		entries: make(map[string]*CacheEntry),
+		visited: make(map[string]bool),
+	}
+
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &cache.entries); err != nil {
+		return nil, fmt.Errorf("failed to parse cache file: %w", err)
+	}
+
+	return cache, nil
+}
+
+// Get returns the cached entry for a URL, or nil if there is none
+func (c *Cache) Get(u string) *CacheEntry {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries[u]
+}
+
+// Put stores the entry for a URL and marks it as visited
+func (c *Cache) Put(u string, entry *CacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[u] = entry
+	c.visited[u] = true
+}
+
+// Prune removes the entries of URLs not visited during this crawl
+func (c *Cache) Prune() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for u := range c.entries {
+		if !c.visited[u] {
+			delete(c.entries, u)
+		}
+	}
+}
+
+// Save atomically writes the cache to a file
+func (c *Cache) Save(filename string) error {
+	c.mu.Lock()
+	data, err := json.Marshal(c.entries)
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode cache: %w", err)
+	}
+
+	if err := writeFileAtomic(filename, data); err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	return nil
+}
+
+// updateCache records a successfully fetched page in the crawl cache.
+// Redirected URLs are not cached, as their validators belong to the target.
+func (c *Crawler) updateCache(item *QueueItem, page *Page) {
+	if c.cache == nil || len(page.Redirects) > 0 {
+		return
+	}
+	c.cache.Put(item.URL.String(), newCacheEntry(page))
+}
+
+// saveCache writes the crawl cache to the cache file. Entries of URLs that
+// were not visited are dropped if the crawl ran to completion.
+func (c *Crawler) saveCache(ctx context.Context) {
+	if c.cache == nil {
+		return
+	}
+	if ctx.Err() == nil && c.BudgetReached() == "" {
+		c.cache.Prune()
+	}
+	if err := c.cache.Save(c.config.CacheFile); err != nil {
+		c.setErr(err)
+	}
+}
+
+// newCacheEntry creates the cache entry for a fetched page
+func newCacheEntry(page *Page) *CacheEntry {
+	entry := &CacheEntry{
+		ETag:          page.ETag,
+		LastModified:  page.LastModifiedHeader,
+		ContentHash:   page.ContentHash,
+		LastMod:       page.LastModified,
+		ContentType:   page.ContentType,
+		Links:         urlStrings(page.Links),
+		NoFollowLinks: urlStrings(page.NoFollowLinks),
+		Images:        urlStrings(page.Images),
+		NoIndex:       page.NoIndex,
+		NoFollow:      page.NoFollow,
+		ParseSkipped:  page.ParseSkipped,
+		CrawledAt:     time.Now(),
+	}
+	if page.Canonical != nil {
+		entry.Canonical = page.Canonical.String()
+	}
+	return entry
+}
+
+// apply restores the state of an unchanged page from the cache entry
+func (e *CacheEntry) apply(page *Page) {
+	page.ETag = e.ETag
+	page.LastModifiedHeader = e.LastModified
+	page.ContentHash = e.ContentHash
+	page.LastModified = e.LastMod
+	page.ContentType = e.ContentType
+	page.Links = parseURLs(e.Links)
+	page.NoFollowLinks = parseURLs(e.NoFollowLinks)
+	page.Images = parseURLs(e.Images)
+	page.NoIndex = e.NoIndex
+	page.NoFollow = e.NoFollow
+	page.ParseSkipped = e.ParseSkipped
+	if e.Canonical != "" {
+		page.Canonical, _ = url.Parse(e.Canonical)
+	}
+}
+
+// urlStrings converts URLs to strings
+func urlStrings(urls []*url.URL) []string {
+	strs := make([]string, 0, len(urls))
+	for _, u := range urls {
+		strs = append(strs, u.String())
+	}
+	return strs
+}
+
+// parseURLs parses URL strings, skipping invalid ones
+func parseURLs(strs []string) []*url.URL {
+	urls := make([]*url.URL, 0, len(strs))
+	for _, s := range strs {
+		if u, err := url.Parse(s); err == nil {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
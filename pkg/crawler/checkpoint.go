@@ -0,0 +1,190 @@
+package crawler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Checkpoint is the on-disk state of an interrupted crawl
+type Checkpoint struct {
+	// BaseURL is the start URL of the crawl the checkpoint belongs to
+	BaseURL string `json:"base_url"`
+
+	// SavedAt is the time the checkpoint was written
+	SavedAt time.Time `json:"saved_at"`
+
+	// Pending contains the URLs still to be processed
+	Pending []CheckpointItem `json:"pending"`
+
+	// Seen contains every URL that has been queued
+	Seen []string `json:"seen"`
+
+	// Results contains the results collected so far
+	Results []CheckpointResult `json:"results"`
+}
+
+// CheckpointItem is a serializable QueueItem
+type CheckpointItem struct {
+	URL   string `json:"url"`
+	Depth int    `json:"depth"`
+}
+
+// CheckpointResult is a serializable Result
+type CheckpointResult struct {
+	Result
+
+	// Error holds the message of Result.Error, if any
+	Error string `json:"error,omitempty"`
+}
+
+// LoadCheckpoint reads a checkpoint from a state file
+func LoadCheckpoint(filename string) (*Checkpoint, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("failed to parse state file: %w", err)
+	}
+
+	return &cp, nil
+}
+
+// Save atomically writes the checkpoint to a state file
+func (cp *Checkpoint) Save(filename string) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+
+	if err := writeFileAtomic(filename, data); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file first and renames it,
+// so an interrupted write never corrupts the previous contents of filename
+func writeFileAtomic(filename string, data []byte) error {
+	dir := filepath.Dir(filename)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
+
+// snapshot captures the current crawl state as a checkpoint
+func (c *Crawler) snapshot() *Checkpoint {
+	// Block workers from completing items while the state is captured,
+	// so every item is either pending or has its result recorded
+	c.checkpointMu.Lock()
+	defer c.checkpointMu.Unlock()
+
+	pending, seen := c.queue.Snapshot()
+
+	cp := &Checkpoint{
+		BaseURL: c.config.BaseURL.String(),
+		SavedAt: time.Now(),
+		Pending: make([]CheckpointItem, 0, len(pending)),
+		Seen:    seen,
+		Results: make([]CheckpointResult, 0, len(c.collected)),
+	}
+
+	for _, item := range pending {
+		cp.Pending = append(cp.Pending, CheckpointItem{
+			URL:   item.URL.String(),
+			Depth: item.Depth,
+		})
+	}
+
+	for _, result := range c.collected {
+		cr := CheckpointResult{Result: *result}
+		if result.Error != nil {
+			cr.Error = result.Error.Error()
+		}
+		cp.Results = append(cp.Results, cr)
+	}
+
+	return cp
+}
+
+// restore loads the queue and collected results from a checkpoint and
+// returns the restored results so they can be replayed to the consumer
+func (c *Crawler) restore(cp *Checkpoint) ([]*Result, error) {
+	if cp.BaseURL != c.config.BaseURL.String() {
+		return nil, fmt.Errorf("state file belongs to a crawl of %s", cp.BaseURL)
+	}
+
+	pending := make([]*QueueItem, 0, len(cp.Pending))
+	for _, item := range cp.Pending {
+		u, err := url.Parse(item.URL)
+		if err != nil {
+			continue
+		}
+		pending = append(pending, &QueueItem{URL: u, Depth: item.Depth})
+	}
+	c.queue.Restore(pending, cp.Seen)
+
+	results := make([]*Result, 0, len(cp.Results))
+	for _, cr := range cp.Results {
+		result := cr.Result
+		if cr.Error != "" {
+			result.Error = errors.New(cr.Error)
+		}
+		results = append(results, &result)
+	}
+	c.collected = append(c.collected, results...)
+
+	// Restored pages count towards the crawl budget
+	c.budget.pages = len(results)
+	for _, result := range results {
+		c.budget.bytes += result.Size
+	}
+
+	return results, nil
+}
+
+// checkpoint writes the current crawl state to the configured state file
+func (c *Crawler) checkpoint() {
+	if err := c.snapshot().Save(c.config.StateFile); err != nil {
+		c.setErr(fmt.Errorf("failed to save checkpoint: %w", err))
+	}
+}
+
+// checkpointLoop periodically writes checkpoints until the crawl is done
+func (c *Crawler) checkpointLoop() {
+	ticker := time.NewTicker(c.config.CheckpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.checkpoint()
+		case <-c.done:
+			return
+		}
+	}
+}
@@ -4,8 +4,29 @@ import (
 	"fmt"
 	"net/url"
 	"time"
+
+	"github.com/ncecere/mapper/pkg/scope"
+	"github.com/ncecere/mapper/pkg/urlnorm"
 )
 
+// DefaultSkipExtensions are the file extensions of common non-content
+// resources that are not crawled by default
+var DefaultSkipExtensions = []string{
+	".jpg", ".jpeg", ".png", ".gif", ".ico", ".css", ".js",
+	".pdf", ".doc", ".docx", ".ppt", ".pptx", ".xls", ".xlsx",
+	".zip", ".tar", ".gz", ".rar", ".exe", ".mp3", ".mp4",
+	".avi", ".mov", ".wmv", ".flv", ".svg", ".woff", ".woff2",
+	".ttf", ".eot",
+}
+
+// DefaultBoilerplateSelectors are the elements that commonly hold a site's
+// shared template rather than page content
+var DefaultBoilerplateSelectors = []string{"nav", "header", "footer", "aside"}
+
+// DefaultLastModSources are the sources of a page's last modification
+// time, in order of precedence
+var DefaultLastModSources = []string{LastModMeta, LastModJSONLD, LastModHeader, LastModTime}
+
 // Config holds the configuration for the crawler
 type Config struct {
 	// BaseURL is the starting point for crawling
@@ -22,21 +43,144 @@ type Config struct {
 	// RequestTimeout defines the timeout for each HTTP request
 	RequestTimeout time.Duration
 
-	// RateLimit defines the minimum time between requests to the same domain
+	// RateLimit defines the minimum time between requests to the same host,
+	// shared by all concurrent workers
 	RateLimit time.Duration
 
+	// RateBurst defines how many requests to a host may be made back to back
+	// before RateLimit applies
+	RateBurst int
+
+	// AdaptiveRate slows requests to a host down when its response latency
+	// or rate of 429/503 responses rises, and speeds back up to RateLimit
+	// while it is healthy
+	AdaptiveRate bool
+
 	// UserAgent is the User-Agent string to use in HTTP requests
 	UserAgent string
 
 	// FollowRedirects determines if the crawler should follow HTTP redirects
 	FollowRedirects bool
 
-	// ExcludePatterns contains regex patterns for URLs to exclude from crawling
+	// ExcludePatterns contains patterns for URLs to exclude from crawling:
+	// path globs such as /admin/** or regexes against the full URL prefixed
+	// with re:
 	ExcludePatterns []string
 
-	// IncludePatterns contains regex patterns for URLs to include in crawling
+	// IncludePatterns contains patterns for URLs to include in crawling, in
+	// the same syntax as ExcludePatterns
 	// If empty, all URLs not matching exclude patterns are included
 	IncludePatterns []string
+
+	// MaxPages is the maximum number of pages to fetch, including those
+	// restored from a checkpoint (0 for no limit)
+	MaxPages int
+
+	// MaxDuration is the maximum time to crawl for (0 for no limit)
+	MaxDuration time.Duration
+
+	// MaxBytes is the maximum number of response body bytes to download,
+	// including those of pages restored from a checkpoint (0 for no limit)
+	MaxBytes int64
+
+	// ScopePrefixes restricts the crawl to URLs whose path is under one of
+	// these prefixes, matching whole path segments. If empty, all paths are
+	// in scope.
+	ScopePrefixes []string
+
+	// PassThrough contains paths outside ScopePrefixes that are fetched for
+	// link discovery but not listed; a trailing * matches any suffix.
+	// The base URL is always passed through if it is outside the prefixes.
+	PassThrough []string
+
+	// RespectRobots determines if the crawler should obey robots.txt rules
+	// A Crawl-delay larger than RateLimit replaces RateLimit
+	RespectRobots bool
+
+	// StateFile is the file crawl checkpoints are written to
+	// If empty, no checkpoints are written
+	StateFile string
+
+	// CheckpointInterval defines how often the crawl state is checkpointed
+	// A checkpoint is always written when the crawl is interrupted
+	CheckpointInterval time.Duration
+
+	// Resume restarts the crawl from the checkpoint in StateFile
+	Resume bool
+
+	// CacheFile is the path of the persistent crawl cache. When set, pages
+	// are fetched with conditional requests and unchanged pages are restored
+	// from the cache, and pages without a Last-Modified header keep their
+	// last modification time while their content hash is unchanged. If
+	// empty, no cache is used.
+	CacheFile string
+
+	// BoilerplateSelectors are the elements left out of a page's content
+	// hash, so that changes to shared templates such as navigation or
+	// footers don't change every page's last modification time. Selectors
+	// are element names, .class or #id.
+	BoilerplateSelectors []string
+
+	// LastModSources are the sources of a page's last modification time in
+	// order of precedence: meta (article:modified_time and similar meta
+	// tags), jsonld (dateModified), header (Last-Modified) and time
+	// (<time> elements marking a modification). Pages without any fall
+	// back to the cache.
+	LastModSources []string
+
+	// SeedFromSitemaps adds the URLs listed in the site's existing sitemaps
+	// (/sitemap.xml and robots.txt Sitemap directives) as depth 0 seeds
+	SeedFromSitemaps bool
+
+	// MaxBodySize is the maximum number of bytes read from a response body;
+	// longer pages are truncated (0 for no limit)
+	MaxBodySize int64
+
+	// SkipExtensions contains the file extensions of non-content URLs that
+	// are not crawled
+	SkipExtensions []string
+
+	// ListExtensions contains file extensions of resources, e.g. .pdf, that
+	// are listed but not parsed for links, even if in SkipExtensions
+	ListExtensions []string
+
+	// SniffWithHead checks the Content-Type of URLs without a file extension
+	// with a HEAD request before fetching them, so non-HTML resources are
+	// not downloaded
+	SniffWithHead bool
+
+	// ListContentTypes contains non-HTML media types, e.g. application/pdf,
+	// that are listed although they are not parsed for links; type/*
+	// matches all subtypes
+	ListContentTypes []string
+
+	// MaxRetries defines how many times a fetch failing with a network error
+	// or a 429/5xx response is retried
+	MaxRetries int
+
+	// RetryMaxWait defines the maximum time to wait before a retry,
+	// including delays requested by Retry-After headers
+	RetryMaxWait time.Duration
+
+	// Scope holds the hosts that may be crawled. If nil, only the host of
+	// BaseURL is crawled.
+	Scope *scope.Scope
+
+	// Normalizer normalizes discovered URLs before they are deduplicated
+	// and crawled. If nil, URLs are only resolved and stripped of fragments.
+	Normalizer *urlnorm.Normalizer
+
+	// CollectLinks adds the followable links found on each page to its
+	// result, e.g. to count inbound links
+	CollectLinks bool
+
+	// CollectImages adds the URLs of the images found on each page to its
+	// result, e.g. for an image sitemap
+	CollectImages bool
+
+	// RespectNoFollow determines if rel="nofollow" links and pages with a
+	// nofollow meta robots tag or X-Robots-Tag header are left unfollowed
+	RespectNoFollow bool
 }
 
 // DefaultConfig returns a Config with sensible default values
@@ -47,13 +191,23 @@ func DefaultConfig(baseURL string) (*Config, error) {
 	}
 
 	return &Config{
-		BaseURL:         parsedURL,
-		MaxDepth:        3,
-		MaxConcurrent:   5,
-		RequestTimeout:  10 * time.Second,
-		RateLimit:       time.Second,
-		UserAgent:       "Mapper/1.0 (+https://github.com/ncecere/mapper)",
-		FollowRedirects: true,
+		BaseURL:            parsedURL,
+		MaxDepth:           3,
+		MaxConcurrent:      5,
+		RequestTimeout:     10 * time.Second,
+		RateLimit:          time.Second,
+		RateBurst:          1,
+		UserAgent:          "Mapper/1.0 (+https://github.com/ncecere/mapper)",
+		FollowRedirects:    true,
+		RespectRobots:      true,
+		RespectNoFollow:    true,
+		MaxBodySize:        10 * 1024 * 1024,
+		SkipExtensions:     append([]string(nil), DefaultSkipExtensions...),
+		MaxRetries:         2,
+		RetryMaxWait:       30 * time.Second,
+		Normalizer:         urlnorm.NewFromOptions(urlnorm.DefaultOptions()),
+		CheckpointInterval: 30 * time.Second,
+		LastModSources:     append([]string(nil), DefaultLastModSources...),
 	}, nil
 }
 
@@ -79,10 +233,50 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("rate limit must be non-negative")
 	}
 
+	if c.RateBurst < 1 {
+		return fmt.Errorf("rate burst must be at least 1")
+	}
+
 	if c.UserAgent == "" {
 		return fmt.Errorf("user agent is required")
 	}
 
+	if c.MaxBodySize < 0 {
+		return fmt.Errorf("max body size must be non-negative")
+	}
+
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("max retries must be non-negative")
+	}
+
+	if err := validateLastModSources(c.LastModSources); err != nil {
+		return err
+	}
+
+	if c.RetryMaxWait < 0 {
+		return fmt.Errorf("retry max wait must be non-negative")
+	}
+
+	if c.CheckpointInterval < 0 {
+		return fmt.Errorf("checkpoint interval must be non-negative")
+	}
+
+	if c.MaxPages < 0 {
+		return fmt.Errorf("max pages must be non-negative")
+	}
+
+	if c.MaxDuration < 0 {
+		return fmt.Errorf("max duration must be non-negative")
+	}
+
+	if c.MaxBytes < 0 {
+		return fmt.Errorf("max bytes must be non-negative")
+	}
+
+	if c.Resume && c.StateFile == "" {
+		return fmt.Errorf("a state file is required to resume a crawl")
+	}
+
 	return nil
 }
 
@@ -117,6 +311,20 @@ func WithRateLimit(limit time.Duration) Option {
 	}
 }
 
+// WithRateBurst sets the number of requests allowed back to back
+func WithRateBurst(burst int) Option {
+	return func(c *Config) {
+		c.RateBurst = burst
+	}
+}
+
+// WithAdaptiveRate sets whether the rate adapts to the host's health
+func WithAdaptiveRate(adaptive bool) Option {
+	return func(c *Config) {
+		c.AdaptiveRate = adaptive
+	}
+}
+
 // WithUserAgent sets the User-Agent string
 func WithUserAgent(userAgent string) Option {
 	return func(c *Config) {
@@ -138,9 +346,187 @@ func WithExcludePatterns(patterns []string) Option {
 	}
 }
 
+// WithCacheFile sets the path of the persistent crawl cache
+func WithCacheFile(filename string) Option {
+	return func(c *Config) {
+		c.CacheFile = filename
+	}
+}
+
+// WithMaxPages sets the maximum number of pages to fetch
+func WithMaxPages(pages int) Option {
+	return func(c *Config) {
+		c.MaxPages = pages
+	}
+}
+
+// WithMaxDuration sets the maximum time to crawl for
+func WithMaxDuration(d time.Duration) Option {
+	return func(c *Config) {
+		c.MaxDuration = d
+	}
+}
+
+// WithMaxBytes sets the maximum number of response body bytes to download
+func WithMaxBytes(bytes int64) Option {
+	return func(c *Config) {
+		c.MaxBytes = bytes
+	}
+}
+
+// WithScopePrefixes sets the path prefixes the crawl is restricted to
+func WithScopePrefixes(prefixes []string) Option {
+	return func(c *Config) {
+		c.ScopePrefixes = prefixes
+	}
+}
+
+// WithPassThrough sets the paths fetched for link discovery but not listed
+func WithPassThrough(paths []string) Option {
+	return func(c *Config) {
+		c.PassThrough = paths
+	}
+}
+
 // WithIncludePatterns sets the URL patterns to include
 func WithIncludePatterns(patterns []string) Option {
 	return func(c *Config) {
 		c.IncludePatterns = patterns
 	}
 }
+
+// WithRespectRobots sets whether to obey robots.txt rules
+func WithRespectRobots(respect bool) Option {
+	return func(c *Config) {
+		c.RespectRobots = respect
+	}
+}
+
+// WithStateFile sets the file crawl checkpoints are written to
+func WithStateFile(filename string) Option {
+	return func(c *Config) {
+		c.StateFile = filename
+	}
+}
+
+// WithCheckpointInterval sets how often the crawl state is checkpointed
+func WithCheckpointInterval(interval time.Duration) Option {
+	return func(c *Config) {
+		c.CheckpointInterval = interval
+	}
+}
+
+// WithResume sets whether to resume from the checkpoint in the state file
+func WithResume(resume bool) Option {
+	return func(c *Config) {
+		c.Resume = resume
+	}
+}
+
+// WithSeedFromSitemaps sets whether to seed the crawl from existing sitemaps
+func WithSeedFromSitemaps(seed bool) Option {
+	return func(c *Config) {
+		c.SeedFromSitemaps = seed
+	}
+}
+
+// WithRespectNoFollow sets whether to honor nofollow directives
+func WithRespectNoFollow(respect bool) Option {
+	return func(c *Config) {
+		c.RespectNoFollow = respect
+	}
+}
+
+// WithCollectLinks sets whether followable links are added to results
+func WithCollectLinks(collect bool) Option {
+	return func(c *Config) {
+		c.CollectLinks = collect
+	}
+}
+
+// WithCollectImages sets whether image URLs are added to results
+func WithCollectImages(collect bool) Option {
+	return func(c *Config) {
+		c.CollectImages = collect
+	}
+}
+
+// WithMaxBodySize sets the maximum number of bytes read from a response body
+func WithMaxBodySize(size int64) Option {
+	return func(c *Config) {
+		c.MaxBodySize = size
+	}
+}
+
+// WithBoilerplateSelectors sets the elements left out of content hashes
+func WithBoilerplateSelectors(selectors []string) Option {
+	return func(c *Config) {
+		c.BoilerplateSelectors = selectors
+	}
+}
+
+// WithLastModSources sets the sources of last modification times in order
+// of precedence
+func WithLastModSources(sources []string) Option {
+	return func(c *Config) {
+		c.LastModSources = sources
+	}
+}
+
+// WithSkipExtensions sets the file extensions of URLs that are not crawled
+func WithSkipExtensions(extensions []string) Option {
+	return func(c *Config) {
+		c.SkipExtensions = extensions
+	}
+}
+
+// WithListExtensions sets the file extensions of resources that are listed
+// but not parsed
+func WithListExtensions(extensions []string) Option {
+	return func(c *Config) {
+		c.ListExtensions = extensions
+	}
+}
+
+// WithSniffWithHead enables HEAD requests to check the Content-Type of URLs
+// without a file extension
+func WithSniffWithHead(sniff bool) Option {
+	return func(c *Config) {
+		c.SniffWithHead = sniff
+	}
+}
+
+// WithListContentTypes sets the non-HTML media types that are listed
+func WithListContentTypes(types []string) Option {
+	return func(c *Config) {
+		c.ListContentTypes = types
+	}
+}
+
+// WithMaxRetries sets how many times a failed fetch is retried
+func WithMaxRetries(retries int) Option {
+	return func(c *Config) {
+		c.MaxRetries = retries
+	}
+}
+
+// WithRetryMaxWait sets the maximum time to wait before a retry
+func WithRetryMaxWait(wait time.Duration) Option {
+	return func(c *Config) {
+		c.RetryMaxWait = wait
+	}
+}
+
+// WithNormalizer sets the URL normalizer
+func WithNormalizer(normalizer *urlnorm.Normalizer) Option {
+	return func(c *Config) {
+		c.Normalizer = normalizer
+	}
+}
+
+// WithScope sets the hosts that may be crawled
+func WithScope(s *scope.Scope) Option {
+	return func(c *Config) {
+		c.Scope = s
+	}
+}
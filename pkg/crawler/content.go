@@ -0,0 +1,78 @@
+package crawler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// nonContentElements are elements whose text is never page content
+var nonContentElements = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"noscript": true,
+	"template": true,
+}
+
+// contentHash returns the hex-encoded SHA-256 hash of the text content of a
+// document. Whitespace is collapsed, and scripts, styles and elements
+// matching any of the boilerplate selectors are left out, so the hash only
+// changes when the page content does.
+func contentHash(doc *html.Node, boilerplate []string) string {
+	hash := sha256.New()
+	var traverse func(*html.Node)
+	traverse = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			for _, word := range strings.Fields(n.Data) {
+				hash.Write([]byte(word))
+				hash.Write([]byte{' '})
+			}
+			return
+		case html.ElementNode:
+			if nonContentElements[n.Data] || matchSelectors(n, boilerplate) {
+				return
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			traverse(c)
+		}
+	}
+
+	traverse(doc)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// matchSelectors reports whether an element matches any of the selectors,
+// each of which is an element name, .class or #id
+func matchSelectors(n *html.Node, selectors []string) bool {
+	for _, selector := range selectors {
+		selector = strings.TrimSpace(selector)
+		switch {
+		case strings.HasPrefix(selector, "."):
+			if hasToken(attr(n, "class"), selector[1:]) {
+				return true
+			}
+		case strings.HasPrefix(selector, "#"):
+			if id := attr(n, "id"); id != "" && id == selector[1:] {
+				return true
+			}
+		case strings.EqualFold(n.Data, selector):
+			return true
+		}
+	}
+	return false
+}
+
+// attr returns the value of an element's attribute, or "" if it is not set
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"os"
 	"sync"
 	"time"
+
+	"github.com/ncecere/mapper/pkg/scope"
 )
 
 // Result represents the outcome of crawling a URL
@@ -14,9 +17,23 @@ type Result struct {
 	URL         string    // The URL that was crawled
 	LastMod     time.Time // Last modification time
 	StatusCode  int       // HTTP status code
-	Error       error     // Any error that occurred
+	Error       error     `json:"-"` // Any error that occurred
 	Depth       int       // Depth from the start URL
 	TimeToFetch time.Duration
+	NoIndex     bool       // The page asked not to be indexed
+	Canonical   string     // Canonical URL declared by the page, if any
+	FinalURL    string     // URL of the final response after redirects
+	Redirects   []Redirect // Redirect hops followed to reach FinalURL
+	ContentType string     // Content-Type of the final response
+	Attempts    int        // Number of fetch attempts, including retries
+	PassThrough bool       // Fetched for link discovery only; not to be listed
+	Size        int64      // Bytes of the response body downloaded
+	Truncated   bool       // The body exceeded the maximum size and was cut short
+	SkipReason  string     // Why the body was not parsed for links, if it wasn't
+	Unlisted    bool       // Not to be listed, e.g. because of its content type
+	NotModified bool       // Unchanged since it was cached; restored from the cache
+	Links       []string   // Followable links found on the page, if collected
+	Images      []string   // Image URLs found on the page, if collected
 }
 
 // Crawler manages the web crawling process
@@ -25,6 +42,11 @@ type Crawler struct {
 	queue     *URLQueue
 	validator *URLValidator
 	client    *http.Client
+	scheduler *Scheduler
+
+	// resourceClient fetches robots.txt and sitemaps. It follows redirects
+	// regardless of the crawl filters, which only apply to pages.
+	resourceClient *http.Client
 
 	// Statistics
 	stats struct {
@@ -34,6 +56,25 @@ type Crawler struct {
 		start     time.Time
 	}
 
+	// budget tracks the page, byte and duration limits
+	budget budget
+
+	// cache is the persistent crawl cache, if enabled
+	cache *Cache
+
+	// robots holds the robots.txt rules of each host, fetched on first use
+	robotsMu sync.Mutex
+	robots   map[string]*robotsEntry
+
+	// Checkpoint state; checkpointMu also serializes item completion so
+	// snapshots are consistent
+	checkpointMu sync.Mutex
+	collected    []*Result
+
+	// err holds the first non-fatal error encountered, e.g. a failed checkpoint
+	errMu sync.Mutex
+	err   error
+
 	// Channels for coordination
 	results chan *Result
 	done    chan struct{}
@@ -45,6 +86,12 @@ func NewCrawler(config *Config) (*Crawler, error) {
 		return nil, fmt.Errorf("invalid config: %w", err)
 	}
 
+	// Normalize the base URL so it matches normalized discovered URLs
+	config.BaseURL = config.Normalizer.Normalize(config.BaseURL)
+	if config.Scope == nil {
+		config.Scope = scope.Exact(config.BaseURL)
+	}
+
 	validator, err := NewURLValidator(
 		config.BaseURL,
 		config.ExcludePatterns,
@@ -60,6 +107,11 @@ func NewCrawler(config *Config) (*Crawler, error) {
 			if !config.FollowRedirects {
 				return http.ErrUseLastResponse
 			}
+			// Stop at redirects to URLs that aren't crawled, so their
+			// targets are never listed
+			if !validator.ShouldFollowRedirect(req.URL) {
+				return http.ErrUseLastResponse
+			}
 			if len(via) >= 10 {
 				return fmt.Errorf("stopped after 10 redirects")
 			}
@@ -67,14 +119,32 @@ func NewCrawler(config *Config) (*Crawler, error) {
 		},
 	}
 
+	resourceClient := &http.Client{
+		Timeout: config.RequestTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			// An unresolved redirect chain is returned as is
+			if len(via) > maxResourceRedirects {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+
 	c := &Crawler{
-		config:    config,
-		queue:     NewURLQueue(config.BaseURL),
-		validator: validator,
-		client:    client,
-		results:   make(chan *Result),
-		done:      make(chan struct{}),
+		config:         config,
+		queue:          NewURLQueue(config.BaseURL),
+		validator:      validator,
+		client:         client,
+		resourceClient: resourceClient,
+		results:        make(chan *Result),
+		done:           make(chan struct{}),
+		robots:         make(map[string]*robotsEntry),
 	}
+	c.queue.SetNormalizer(config.Normalizer)
+	c.queue.SetScope(config.Scope)
+	c.validator.SetScope(config.Scope)
+	c.validator.SetPathScope(config.ScopePrefixes, config.PassThrough)
+	c.validator.SetExtensions(config.SkipExtensions, config.ListExtensions)
 
 	return c, nil
 }
@@ -84,8 +154,47 @@ func (c *Crawler) Start(ctx context.Context) (<-chan *Result, error) {
 	// Initialize statistics
 	c.stats.start = time.Now()
 
-	// Add the start URL to the queue
-	c.queue.Push([]*url.URL{c.config.BaseURL}, 0)
+	// Load the crawl cache for conditional requests
+	if c.config.CacheFile != "" {
+		cache, err := LoadCache(c.config.CacheFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load crawl cache: %w", err)
+		}
+		c.cache = cache
+	}
+
+	// Share the request rate across all workers
+	c.scheduler = NewScheduler(c.config.RateLimit, c.config.RateBurst, c.config.AdaptiveRate)
+
+	// Load robots.txt rules for the base host; other hosts are loaded
+	// when their first URL is processed
+	var robots *RobotsRules
+	if c.config.RespectRobots || c.config.SeedFromSitemaps {
+		var err error
+		robots, err = c.loadRobots(ctx, c.config.BaseURL)
+		if err != nil && c.config.RespectRobots {
+			return nil, fmt.Errorf("failed to load robots.txt: %w", err)
+		}
+	}
+
+	// Restore a previous crawl or start from the base URL
+	var replay []*Result
+	if c.config.Resume {
+		cp, err := LoadCheckpoint(c.config.StateFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resume crawl: %w", err)
+		}
+		if replay, err = c.restore(cp); err != nil {
+			return nil, fmt.Errorf("failed to resume crawl: %w", err)
+		}
+	} else {
+		c.queue.Push([]*url.URL{c.config.BaseURL}, 0)
+
+		// Seed the crawl with the URLs of the site's existing sitemaps
+		if c.config.SeedFromSitemaps {
+			c.queue.Push(DiscoverSitemapURLs(ctx, c.resourceClient, c.config.BaseURL, c.config.UserAgent, robots), 0)
+		}
+	}
 
 	// Start worker goroutines
 	var wg sync.WaitGroup
@@ -94,9 +203,62 @@ func (c *Crawler) Start(ctx context.Context) (<-chan *Result, error) {
 		go c.worker(ctx, &wg)
 	}
 
+	// Replay results restored from a checkpoint
+	if len(replay) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, result := range replay {
+				select {
+				case c.results <- result:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	// Periodically checkpoint the crawl state
+	if c.config.StateFile != "" && c.config.CheckpointInterval > 0 {
+		go c.checkpointLoop()
+	}
+
+	// Stop the crawl once the duration limit is reached
+	if c.config.MaxDuration > 0 {
+		timer := time.AfterFunc(c.config.MaxDuration, func() {
+			c.stopBudget(fmt.Sprintf("duration limit of %s", c.config.MaxDuration))
+		})
+		go func() {
+			<-c.done
+			timer.Stop()
+		}()
+	}
+
+	// Release waiting workers if the crawl is cancelled
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.queue.Close()
+		case <-c.done:
+		}
+	}()
+
 	// Start a goroutine to close results channel when done
 	go func() {
 		wg.Wait()
+		c.settleBudget()
+		c.saveCache(ctx)
+
+		// Save the state of an interrupted or budget-limited crawl, or
+		// discard it once complete
+		if c.config.StateFile != "" {
+			if ctx.Err() != nil || c.BudgetReached() != "" {
+				c.checkpoint()
+			} else if err := os.Remove(c.config.StateFile); err != nil && !os.IsNotExist(err) {
+				c.setErr(fmt.Errorf("failed to remove state file: %w", err))
+			}
+		}
+
 		close(c.results)
 		close(c.done)
 	}()
@@ -104,66 +266,173 @@ func (c *Crawler) Start(ctx context.Context) (<-chan *Result, error) {
 	return c.results, nil
 }
 
-// worker processes URLs from the queue
+// worker processes URLs from the queue until the crawl is complete
 func (c *Crawler) worker(ctx context.Context, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	for {
-		select {
-		case <-ctx.Done():
+		// Block until work is available or the crawl is complete
+		item := c.queue.Next()
+		if item == nil {
 			return
-		default:
-			// Get next URL from queue
-			item := c.queue.Pop()
-			if item == nil {
-				return
-			}
+		}
 
-			// Skip if URL is invalid
-			if !c.validator.IsValid(item.URL) {
-				continue
-			}
+		// An item abandoned due to cancellation stays in flight so it is
+		// checkpointed as pending
+		if !c.process(ctx, item) {
+			return
+		}
+	}
+}
 
-			// Skip if beyond max depth
-			if item.Depth > c.config.MaxDepth {
-				continue
-			}
+// process crawls a single queue item and enqueues the links it discovers.
+// It returns false if the item was abandoned because the crawl was cancelled.
+func (c *Crawler) process(ctx context.Context, item *QueueItem) bool {
+	if ctx.Err() != nil {
+		return false
+	}
 
-			// Process the page
-			start := time.Now()
-			page := NewPage(item.URL, item.Depth)
-			err := page.Process(c.client)
-			duration := time.Since(start)
-
-			// Update statistics
-			c.stats.Lock()
-			c.stats.processed++
-			if err != nil {
-				c.stats.errors++
-			}
-			c.stats.Unlock()
-
-			// Send result
-			c.results <- &Result{
-				URL:         item.URL.String(),
-				LastMod:     page.LastModified,
-				StatusCode:  http.StatusOK,
-				Error:       err,
-				Depth:       item.Depth,
-				TimeToFetch: duration,
-			}
+	// Load the robots.txt rules of the URL's host before validating it
+	if c.config.RespectRobots {
+		c.loadRobots(ctx, item.URL)
+	}
 
-			// If page was processed successfully, add its links to the queue
-			if err == nil {
-				c.queue.Push(page.Links, item.Depth+1)
-			}
+	// Skip if URL is invalid or beyond max depth
+	if !c.validator.IsValid(item.URL) || item.Depth > c.config.MaxDepth {
+		c.complete(item, nil, nil)
+		return true
+	}
 
-			// Rate limiting
-			if c.config.RateLimit > 0 {
-				time.Sleep(c.config.RateLimit)
-			}
+	// Stop once a crawl limit has been reached; the item stays pending
+	if !c.startPage() {
+		return false
+	}
+
+	// Process the page, retrying transient failures
+	start := time.Now()
+	page, attempts, err := c.fetch(ctx, item)
+	duration := time.Since(start)
+	c.finishPage(page.Size)
+
+	// A fetch that failed because the crawl was cancelled stays pending
+	if err != nil && ctx.Err() != nil {
+		return false
+	}
+
+	// Update statistics
+	c.stats.Lock()
+	c.stats.processed++
+	if err != nil {
+		c.stats.errors++
+	}
+	c.stats.Unlock()
+
+	// Send result
+	result := &Result{
+		URL:         item.URL.String(),
+		LastMod:     page.LastModified,
+		StatusCode:  page.StatusCode,
+		Error:       err,
+		Depth:       item.Depth,
+		TimeToFetch: duration,
+		NoIndex:     page.NoIndex,
+		FinalURL:    item.URL.String(),
+		Redirects:   page.Redirects,
+		ContentType: page.ContentType,
+		Attempts:    attempts,
+		Size:        page.Size,
+		Truncated:   page.Truncated,
+		SkipReason:  page.ParseSkipped,
+		NotModified: page.NotModified,
+	}
+
+	// Bodies that weren't parsed are only listed for configured content
+	// types and extensions
+	if page.ParseSkipped != "" && !matchContentType(c.config.ListContentTypes, page.ContentType) &&
+		!c.validator.IsListOnly(item.URL) {
+		result.Unlisted = true
+	}
+
+	if c.config.CollectLinks {
+		result.Links = urlStrings(page.Links)
+	}
+	if c.config.CollectImages {
+		result.Images = urlStrings(page.Images)
+	}
+
+	if page.Canonical != nil {
+		result.Canonical = page.Canonical.String()
+	}
+	if page.FinalURL != nil {
+		result.FinalURL = page.FinalURL.String()
+		result.PassThrough = !c.validator.InPathScope(page.FinalURL)
+	} else {
+		result.PassThrough = !c.validator.InPathScope(item.URL)
+	}
+	select {
+	case c.results <- result:
+	case <-ctx.Done():
+		// The consumer may have stopped reading; the item stays pending
+		return false
+	}
+
+	// If page was processed successfully, cache it and add its links to the queue
+	var links []*url.URL
+	if err == nil {
+		c.updateCache(item, page)
+		links = c.followLinks(page)
+	}
+	c.complete(item, result, links)
+
+	return true
+}
+
+// followLinks returns the links of a page that should be crawled,
+// honoring nofollow directives unless configured otherwise
+func (c *Crawler) followLinks(page *Page) []*url.URL {
+	if !c.config.RespectNoFollow {
+		return append(page.Links, page.NoFollowLinks...)
+	}
+	if page.NoFollow {
+		return nil
+	}
+	return page.Links
+}
+
+// complete records the outcome of an item and releases it from the queue
+func (c *Crawler) complete(item *QueueItem, result *Result, links []*url.URL) {
+	c.checkpointMu.Lock()
+	defer c.checkpointMu.Unlock()
+
+	if len(links) > 0 {
+		c.queue.Push(links, item.Depth+1)
+	}
+	if result != nil && result.StatusCode == http.StatusOK && result.FinalURL != result.URL {
+		// The redirect target has been fetched already
+		if finalURL, err := url.Parse(result.FinalURL); err == nil {
+			c.queue.MarkSeen(finalURL)
 		}
 	}
+	if result != nil && c.config.StateFile != "" {
+		c.collected = append(c.collected, result)
+	}
+	c.queue.Done(item)
+}
+
+// setErr records a non-fatal error, keeping the first one
+func (c *Crawler) setErr(err error) {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// Err returns the first non-fatal error encountered during the crawl
+func (c *Crawler) Err() error {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	return c.err
 }
 
 // Wait blocks until crawling is complete
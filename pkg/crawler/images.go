@@ -0,0 +1,57 @@
+package crawler
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ogImageProperties are the Open Graph properties of a page's image
+var ogImageProperties = []string{"og:image", "og:image:url", "og:image:secure_url"}
+
+// extractImages collects the image URLs referenced by an element: the src
+// and srcset of <img>, the srcset of <source> in <picture>, and og:image
+// meta tags
+func (p *Page) extractImages(n *html.Node, images []*url.URL) []*url.URL {
+	var refs []string
+	switch n.Data {
+	case "img":
+		refs = append(refs, attr(n, "src"))
+		refs = append(refs, srcsetURLs(attr(n, "srcset"))...)
+	case "source":
+		if n.Parent != nil && n.Parent.Data == "picture" {
+			refs = append(refs, srcsetURLs(attr(n, "srcset"))...)
+		}
+	case "meta":
+		property := attr(n, "property")
+		if property == "" {
+			property = attr(n, "name")
+		}
+		for _, og := range ogImageProperties {
+			if strings.EqualFold(property, og) {
+				refs = append(refs, attr(n, "content"))
+				break
+			}
+		}
+	}
+
+	for _, ref := range refs {
+		if image := p.normalizeURL(strings.TrimSpace(ref)); image != nil && (image.Scheme == "http" || image.Scheme == "https") {
+			images = append(images, image)
+		}
+	}
+	return images
+}
+
+// srcsetURLs returns the image URLs of a srcset attribute such as
+// "small.jpg 480w, large.jpg 1080w"
+func srcsetURLs(srcset string) []string {
+	var urls []string
+	for _, candidate := range strings.Split(srcset, ",") {
+		if fields := strings.Fields(candidate); len(fields) > 0 {
+			urls = append(urls, fields[0])
+		}
+	}
+	return urls
+}
@@ -0,0 +1,206 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// Last modification time sources
+const (
+	// LastModHeader is the Last-Modified response header
+	LastModHeader = "header"
+
+	// LastModMeta is a meta tag such as article:modified_time or og:updated_time
+	LastModMeta = "meta"
+
+	// LastModJSONLD is a dateModified property in JSON-LD structured data
+	LastModJSONLD = "jsonld"
+
+	// LastModTime is the datetime of a <time itemprop="dateModified">
+	// element or a <time> element inside an <article>
+	LastModTime = "time"
+)
+
+// lastModSources are the valid last modification time sources
+var lastModSources = map[string]bool{
+	LastModHeader: true,
+	LastModMeta:   true,
+	LastModJSONLD: true,
+	LastModTime:   true,
+}
+
+// lastModMetaNames are the names, properties and itemprops of meta tags
+// holding a page's last modification time
+var lastModMetaNames = []string{
+	"article:modified_time",
+	"og:updated_time",
+	"datemodified",
+	"last-modified",
+}
+
+// dateLayouts are the W3C datetime and ISO 8601 layouts accepted for dates
+// in page metadata. Fractional seconds are accepted by all layouts with seconds.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// validateLastModSources checks that all sources are known
+func validateLastModSources(sources []string) error {
+	for _, source := range sources {
+		if !lastModSources[source] {
+			return fmt.Errorf("invalid lastmod source %q: must be %s, %s, %s or %s",
+				source, LastModMeta, LastModJSONLD, LastModHeader, LastModTime)
+		}
+	}
+	return nil
+}
+
+// parseDate parses a date from page metadata, in W3C datetime or HTTP date
+// format. Dates without a time zone are taken to be UTC.
+func parseDate(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// addLastMod records a last modification time found in a source. The
+// latest time of each source is kept; times in the future are ignored, as
+// they are not modification times (e.g. the date of an upcoming event).
+func (p *Page) addLastMod(source string, t time.Time) {
+	if t.IsZero() || t.After(time.Now()) {
+		return
+	}
+	if p.lastMods == nil {
+		p.lastMods = make(map[string]time.Time)
+	}
+	if t.After(p.lastMods[source]) {
+		p.lastMods[source] = t
+	}
+}
+
+// extractLastMod records the last modification times declared by an
+// element in meta tags, JSON-LD or <time> elements
+func (p *Page) extractLastMod(n *html.Node) {
+	switch n.Data {
+	case "meta":
+		for _, key := range []string{"property", "name", "itemprop", "http-equiv"} {
+			if isLastModMetaName(attr(n, key)) {
+				if t, ok := parseDate(attr(n, "content")); ok {
+					p.addLastMod(LastModMeta, t)
+				}
+			}
+		}
+
+	case "script":
+		if mediaType(attr(n, "type")) != "application/ld+json" || n.FirstChild == nil {
+			return
+		}
+		var data any
+		if err := json.Unmarshal([]byte(n.FirstChild.Data), &data); err != nil {
+			return
+		}
+		for _, value := range jsonLDDates(data, nil) {
+			if t, ok := parseDate(value); ok {
+				p.addLastMod(LastModJSONLD, t)
+			}
+		}
+
+	case "time":
+		if !isModifiedTime(n) {
+			return
+		}
+		value := attr(n, "datetime")
+		if value == "" && n.FirstChild != nil && n.FirstChild.Type == html.TextNode {
+			value = n.FirstChild.Data
+		}
+		if t, ok := parseDate(value); ok {
+			p.addLastMod(LastModTime, t)
+		}
+	}
+}
+
+// isModifiedTime reports whether a <time> element holds a modification
+// time: it is marked itemprop="dateModified", or it is unmarked and inside
+// an <article>. Other <time> elements are often event or publication dates.
+func isModifiedTime(n *html.Node) bool {
+	if itemprop := attr(n, "itemprop"); itemprop != "" {
+		return hasToken(itemprop, "dateModified")
+	}
+	for parent := n.Parent; parent != nil; parent = parent.Parent {
+		if parent.Type == html.ElementNode && parent.Data == "article" {
+			return true
+		}
+	}
+	return false
+}
+
+// isLastModMetaName reports whether a meta tag name holds a last
+// modification time
+func isLastModMetaName(name string) bool {
+	for _, lastModName := range lastModMetaNames {
+		if strings.EqualFold(name, lastModName) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonLDDates appends the dateModified values found anywhere in decoded
+// JSON-LD data, including nested objects and @graph arrays
+func jsonLDDates(data any, dates []string) []string {
+	switch v := data.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if s, ok := value.(string); ok && key == "dateModified" {
+				dates = append(dates, s)
+				continue
+			}
+			dates = jsonLDDates(value, dates)
+		}
+	case []any:
+		for _, value := range v {
+			dates = jsonLDDates(value, dates)
+		}
+	}
+	return dates
+}
+
+// resolveLastModified sets the last modification time from the first of
+// LastModSources that declared one. Otherwise the cached time is kept while
+// the content hash is unchanged, so it only moves when the content does,
+// and a new or changed page gets the current time.
+func (p *Page) resolveLastModified() {
+	for _, source := range p.LastModSources {
+		if t, ok := p.lastMods[source]; ok {
+			p.LastModified = t
+			return
+		}
+	}
+	if p.Cached != nil && p.ContentHash != "" && p.ContentHash == p.Cached.ContentHash && !p.Cached.LastMod.IsZero() {
+		p.LastModified = p.Cached.LastMod
+		return
+	}
+	p.LastModified = time.Now()
+}
@@ -1,10 +1,14 @@
 package crawler
 
 import (
+	"bufio"
+	"context"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -20,16 +24,101 @@ type Page struct {
 	Depth int
 
 	// LastModified is the last modification time of the page
-	// This is extracted from the Last-Modified header or current time if not available
+	// This is taken from the first of LastModSources that declares one.
+	// Otherwise it is the cached time if the content hash is unchanged, or
+	// the current time.
 	LastModified time.Time
 
-	// Links contains all unique URLs found on the page
+	// LastModSources are the sources of the last modification time in
+	// order of precedence, e.g. DefaultLastModSources
+	LastModSources []string
+
+	// lastMods holds the last modification time found in each source
+	lastMods map[string]time.Time
+
+	// Links contains all unique URLs found on the page that may be followed
 	Links []*url.URL
 
+	// NoFollowLinks contains the unique URLs of links marked rel="nofollow"
+	NoFollowLinks []*url.URL
+
+	// Images contains the unique URLs of images on the page
+	Images []*url.URL
+
+	// NoIndex is set when a meta robots tag or X-Robots-Tag header asks
+	// for the page to be left out of indexes
+	NoIndex bool
+
+	// NoFollow is set when a meta robots tag or X-Robots-Tag header asks
+	// for the links on the page not to be followed
+	NoFollow bool
+
+	// Canonical is the canonical URL declared by the page, either through
+	// <link rel="canonical"> or a Link header, or nil if none is declared
+	Canonical *url.URL
+
+	// StatusCode is the HTTP status code of the final response
+	StatusCode int
+
+	// FinalURL is the URL of the final response after following redirects
+	// For an unfollowed redirect it is the redirect target
+	FinalURL *url.URL
+
+	// Redirects contains each redirect hop, in order
+	Redirects []Redirect
+
+	// ContentType is the Content-Type of the final response
+	ContentType string
+
+	// Size is the number of bytes of the response body that were read
+	Size int64
+
+	// UserAgent is the User-Agent header sent with the page's requests
+	UserAgent string
+
+	// MaxBodySize is the maximum number of body bytes read; longer bodies
+	// are truncated (0 for no limit)
+	MaxBodySize int64
+
+	// Truncated is set when the body exceeded MaxBodySize
+	Truncated bool
+
+	// ETag and LastModifiedHeader are the validators of the response, used
+	// for conditional requests on the next crawl
+	ETag               string
+	LastModifiedHeader string
+
+	// ContentHash is the hex-encoded SHA-256 hash of the text content of
+	// an HTML page, without boilerplate
+	ContentHash string
+
+	// BoilerplateSelectors are the elements left out of the content hash
+	BoilerplateSelectors []string
+
+	// Cached is the page's entry in the crawl cache, if any. It makes the
+	// request conditional and provides the page's state if it is unchanged.
+	Cached *CacheEntry
+
+	// NotModified is set when the server confirmed the cached page is unchanged
+	NotModified bool
+
+	// ParseSkipped holds the reason the body was not parsed for links,
+	// e.g. a non-HTML content type
+	ParseSkipped string
+
+	// RetryAfter is the delay requested by a Retry-After header, if any
+	RetryAfter time.Duration
+
 	// Error holds any error encountered while processing the page
 	Error error
 }
 
+// Redirect represents a single hop in a redirect chain
+type Redirect struct {
+	URL        string // The URL that redirected
+	StatusCode int    // The redirect status code
+}
+
 // NewPage creates a new Page instance
 func NewPage(pageURL *url.URL, depth int) *Page {
 	return &Page{
@@ -39,12 +128,24 @@ func NewPage(pageURL *url.URL, depth int) *Page {
 	}
 }
 
-// Process fetches and processes the page content
-func (p *Page) Process(client *http.Client) error {
-	req, err := http.NewRequest(http.MethodGet, p.URL.String(), nil)
+// Process fetches and processes the page content.
+// The request is aborted if ctx is cancelled.
+func (p *Page) Process(ctx context.Context, client *http.Client) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL.String(), nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
+	p.setUserAgent(req)
+
+	// Only fetch the page if it changed since it was cached
+	if p.Cached != nil {
+		if p.Cached.ETag != "" {
+			req.Header.Set("If-None-Match", p.Cached.ETag)
+		}
+		if p.Cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", p.Cached.LastModified)
+		}
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -52,21 +153,225 @@ func (p *Page) Process(client *http.Client) error {
 	}
 	defer resp.Body.Close()
 
+	p.StatusCode = resp.StatusCode
+	p.FinalURL = resp.Request.URL
+	p.ContentType = resp.Header.Get("Content-Type")
+	p.Redirects = redirectChain(resp)
+
+	// An unchanged page is restored from the cache
+	if resp.StatusCode == http.StatusNotModified && p.Cached != nil {
+		p.NotModified = true
+		p.Cached.apply(p)
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			p.ETag = etag
+		}
+		return nil
+	}
+
+	// An unfollowed redirect links to its target so it is crawled separately
+	if isRedirect(resp.StatusCode) {
+		if location, err := resp.Location(); err == nil {
+			p.Redirects = append(p.Redirects, Redirect{
+				URL:        p.FinalURL.String(),
+				StatusCode: resp.StatusCode,
+			})
+			p.FinalURL = location
+			p.Links = append(p.Links, location)
+			return nil
+		}
+	}
+
 	if resp.StatusCode != http.StatusOK {
+		p.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
 		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
+	p.applyHeaders(resp.Header)
+
+	// Only HTML is parsed for links; a missing Content-Type is sniffed
+	body := bufio.NewReader(resp.Body)
+	if p.ContentType == "" {
+		sniff, _ := body.Peek(512)
+		p.ContentType = http.DetectContentType(sniff)
+	}
+	if !isHTMLContentType(p.ContentType) {
+		p.ParseSkipped = fmt.Sprintf("content type %s is not HTML", mediaType(p.ContentType))
+		p.resolveLastModified()
+		return nil
+	}
+
+	// Read at most MaxBodySize bytes
+	counter := &countingReader{r: body}
+	var limited io.Reader = counter
+	if p.MaxBodySize > 0 {
+		limited = io.LimitReader(counter, p.MaxBodySize)
+	}
+
+	err = p.parseHTML(limited)
+	p.Size = counter.n
+	p.resolveLastModified()
+
+	// The body was truncated if anything is left beyond the limit
+	if p.MaxBodySize > 0 && counter.n >= p.MaxBodySize {
+		_, readErr := body.ReadByte()
+		p.Truncated = readErr == nil
+	}
+	return err
+}
+
+// isHTMLContentType reports whether a Content-Type header denotes HTML
+func isHTMLContentType(contentType string) bool {
+	switch mediaType(contentType) {
+	case "text/html", "application/xhtml+xml":
+		return true
+	}
+	return false
+}
+
+// mediaType returns the lowercased media type of a Content-Type header,
+// without parameters
+func mediaType(contentType string) string {
+	if mt, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mt
+	}
+	mt, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(mt))
+}
+
+// matchContentType reports whether the media type of a Content-Type header
+// matches any of the patterns, where type/* matches all subtypes
+func matchContentType(patterns []string, contentType string) bool {
+	mt := mediaType(contentType)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+			if strings.HasPrefix(mt, prefix+"/") {
+				return true
+			}
+		} else if mt == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// head requests the page with HEAD and returns the response status code
+// and true if the response shows it is not HTML, in which case the page is
+// complete without a GET request. Any other outcome, including a failed
+// request, leaves it to the GET.
+func (p *Page) head(ctx context.Context, client *http.Client) (int, bool) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, p.URL.String(), nil)
+	if err != nil {
+		return 0, false
+	}
+	p.setUserAgent(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, false
+	}
+	resp.Body.Close()
+
+	contentType := resp.Header.Get("Content-Type")
+	if resp.StatusCode != http.StatusOK || contentType == "" || isHTMLContentType(contentType) {
+		return resp.StatusCode, false
+	}
+
+	p.StatusCode = resp.StatusCode
+	p.FinalURL = resp.Request.URL
+	p.ContentType = contentType
+	p.Redirects = redirectChain(resp)
+	p.applyHeaders(resp.Header)
+	p.resolveLastModified()
+	p.ParseSkipped = fmt.Sprintf("content type %s is not HTML", mediaType(contentType))
+	return resp.StatusCode, true
+}
+
+// setUserAgent sets the User-Agent header of a request, if one is configured
+func (p *Page) setUserAgent(req *http.Request) {
+	if p.UserAgent != "" {
+		req.Header.Set("User-Agent", p.UserAgent)
+	}
+}
+
+// applyHeaders extracts the last modification time, indexing directives
+// and canonical URL from the headers of a successful response
+func (p *Page) applyHeaders(header http.Header) {
+	p.ETag = header.Get("ETag")
+	p.LastModifiedHeader = header.Get("Last-Modified")
+
 	// Extract last modified time
-	if lastMod := resp.Header.Get("Last-Modified"); lastMod != "" {
-		if t, err := time.Parse(time.RFC1123, lastMod); err == nil {
-			p.LastModified = t
+	if lastMod := header.Get("Last-Modified"); lastMod != "" {
+		if t, err := http.ParseTime(lastMod); err == nil {
+			p.addLastMod(LastModHeader, t)
 		}
 	}
-	if p.LastModified.IsZero() {
-		p.LastModified = time.Now()
+
+	// Extract indexing directives from X-Robots-Tag headers
+	for _, value := range header.Values("X-Robots-Tag") {
+		p.applyRobotsHeader(value)
+	}
+
+	// Extract the canonical URL from Link headers
+	for _, value := range header.Values("Link") {
+		if href := parseCanonicalLinkHeader(value); href != "" {
+			p.Canonical = p.normalizeURL(href)
+			break
+		}
+	}
+}
+
+// countingReader counts the bytes read from the underlying reader
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read implements io.Reader
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// redirectChain reconstructs the redirects followed by the client to
+// obtain resp, in the order they occurred
+func redirectChain(resp *http.Response) []Redirect {
+	var chain []Redirect
+	for r := resp.Request.Response; r != nil; r = r.Request.Response {
+		chain = append([]Redirect{{
+			URL:        r.Request.URL.String(),
+			StatusCode: r.StatusCode,
+		}}, chain...)
+	}
+	return chain
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or
+// as an HTTP date, returning zero if it is missing or invalid
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
 	}
+	return 0
+}
 
-	return p.parseHTML(resp.Body)
+// isRedirect reports whether status is an HTTP redirect status code
+func isRedirect(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
 }
 
 // parseHTML parses the HTML content and extracts links
@@ -76,22 +381,50 @@ func (p *Page) parseHTML(body io.Reader) error {
 		return fmt.Errorf("failed to parse HTML: %w", err)
 	}
 
-	var links []*url.URL
+	var links, noFollowLinks, images []*url.URL
 	var traverse func(*html.Node)
 	traverse = func(n *html.Node) {
 		if n.Type == html.ElementNode {
+			p.extractLastMod(n)
+			images = p.extractImages(n, images)
+
 			// Check for <a> tags with href
 			if n.Data == "a" {
+				var rel, href string
 				for _, attr := range n.Attr {
-					if attr.Key == "href" {
-						if link := p.normalizeURL(attr.Val); link != nil {
-							links = append(links, link)
-						}
-						break
+					switch attr.Key {
+					case "rel":
+						rel = attr.Val
+					case "href":
+						href = attr.Val
+					}
+				}
+				if link := p.normalizeURL(href); link != nil {
+					if hasToken(rel, "nofollow") {
+						noFollowLinks = append(noFollowLinks, link)
+					} else {
+						links = append(links, link)
 					}
 				}
 			}
 
+			// Check for <meta name="robots"> indexing directives, or ones
+			// addressed to our product token
+			if n.Data == "meta" {
+				var name, content string
+				for _, attr := range n.Attr {
+					switch attr.Key {
+					case "name":
+						name = attr.Val
+					case "content":
+						content = attr.Val
+					}
+				}
+				if strings.EqualFold(name, "robots") || p.isOwnAgent(name) {
+					p.applyRobotsDirectives(content)
+				}
+			}
+
 			// Check for <link> tags with href (e.g., for canonical URLs)
 			if n.Data == "link" {
 				var rel, href string
@@ -103,9 +436,15 @@ func (p *Page) parseHTML(body io.Reader) error {
 						href = attr.Val
 					}
 				}
-				if (rel == "canonical" || rel == "alternate") && href != "" {
+				if (hasToken(rel, "canonical") || hasToken(rel, "alternate")) && href != "" {
 					if link := p.normalizeURL(href); link != nil {
 						links = append(links, link)
+
+						// The first canonical declaration wins; a Link header
+						// takes precedence over the document
+						if hasToken(rel, "canonical") && p.Canonical == nil {
+							p.Canonical = link
+						}
 					}
 				}
 			}
@@ -119,9 +458,82 @@ func (p *Page) parseHTML(body io.Reader) error {
 
 	traverse(doc)
 	p.Links = uniqueURLs(links)
+	p.NoFollowLinks = uniqueURLs(noFollowLinks)
+	p.Images = uniqueURLs(images)
+	p.ContentHash = contentHash(doc, p.BoilerplateSelectors)
 	return nil
 }
 
+// applyRobotsHeader applies the directives of an X-Robots-Tag header.
+// Values scoped to a specific crawler ("googlebot: noindex") only apply
+// when they name our product token.
+func (p *Page) applyRobotsHeader(value string) {
+	if agent, directives, found := strings.Cut(value, ":"); found {
+		agent = strings.TrimSpace(agent)
+		if !strings.EqualFold(agent, "unavailable_after") && !strings.Contains(agent, ",") {
+			if p.isOwnAgent(agent) {
+				p.applyRobotsDirectives(directives)
+			}
+			return
+		}
+	}
+	p.applyRobotsDirectives(value)
+}
+
+// isOwnAgent reports whether name is the robots product token of our
+// User-Agent, ignoring case
+func (p *Page) isOwnAgent(name string) bool {
+	token := robotsProductToken(p.UserAgent)
+	return token != "" && strings.EqualFold(strings.TrimSpace(name), token)
+}
+
+// applyRobotsDirectives applies a comma-separated list of robots directives
+// such as "noindex, nofollow"
+func (p *Page) applyRobotsDirectives(value string) {
+	for _, directive := range strings.Split(value, ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "noindex":
+			p.NoIndex = true
+		case "nofollow":
+			p.NoFollow = true
+		case "none":
+			p.NoIndex = true
+			p.NoFollow = true
+		}
+	}
+}
+
+// parseCanonicalLinkHeader returns the target of a rel="canonical" entry in
+// a Link header such as `<https://example.com/page>; rel="canonical"`
+func parseCanonicalLinkHeader(value string) string {
+	for _, link := range strings.Split(value, ",") {
+		parts := strings.Split(link, ";")
+		target := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+
+		for _, param := range parts[1:] {
+			key, val, found := strings.Cut(strings.TrimSpace(param), "=")
+			if found && strings.EqualFold(strings.TrimSpace(key), "rel") && hasToken(strings.Trim(val, `"`), "canonical") {
+				return strings.Trim(target, "<>")
+			}
+		}
+	}
+	return ""
+}
+
+// hasToken reports whether a space-separated attribute value such as
+// rel="nofollow noopener" contains token, ignoring case
+func hasToken(value, token string) bool {
+	for _, field := range strings.Fields(value) {
+		if strings.EqualFold(field, token) {
+			return true
+		}
+	}
+	return false
+}
+
 // normalizeURL converts a relative or absolute URL to a normalized absolute URL
 func (p *Page) normalizeURL(rawURL string) *url.URL {
 	// Remove fragment
@@ -140,9 +552,13 @@ func (p *Page) normalizeURL(rawURL string) *url.URL {
 		return nil
 	}
 
-	// Convert relative URLs to absolute
+	// Convert relative URLs to absolute, relative to the final URL after redirects
 	if !parsedURL.IsAbs() {
-		parsedURL = p.URL.ResolveReference(parsedURL)
+		base := p.URL
+		if p.FinalURL != nil {
+			base = p.FinalURL
+		}
+		parsedURL = base.ResolveReference(parsedURL)
 	}
 
 	// Ensure URL has a scheme
@@ -3,6 +3,9 @@ package crawler
 import (
 	"net/url"
 	"sync"
+
+	"github.com/ncecere/mapper/pkg/scope"
+	"github.com/ncecere/mapper/pkg/urlnorm"
 )
 
 // URLQueue manages the queue of URLs to be crawled
@@ -15,8 +18,20 @@ type URLQueue struct {
 	// seen tracks URLs that have been seen to prevent duplicates
 	seen map[string]bool
 
-	// baseHost is the host of the base URL to ensure we stay within domain
-	baseHost string
+	// scope holds the hosts URLs must be on to be queued
+	scope *scope.Scope
+
+	// cond signals waiting consumers when items are pushed or work completes
+	cond *sync.Cond
+
+	// inFlight holds items handed out by Next that are not yet Done
+	inFlight map[*QueueItem]bool
+
+	// closed stops Next from handing out further items
+	closed bool
+
+	// normalizer normalizes URLs before they are deduplicated
+	normalizer *urlnorm.Normalizer
 }
 
 // QueueItem represents a URL in the queue with its depth
@@ -27,11 +42,14 @@ type QueueItem struct {
 
 // NewURLQueue creates a new URLQueue instance
 func NewURLQueue(baseURL *url.URL) *URLQueue {
-	return &URLQueue{
+	q := &URLQueue{
 		queue:    make([]*QueueItem, 0),
 		seen:     make(map[string]bool),
-		baseHost: baseURL.Host,
+		scope:    scope.Exact(baseURL),
+		inFlight: make(map[*QueueItem]bool),
 	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
 }
 
 // Push adds a URL to the queue if it hasn't been seen and matches criteria
@@ -40,13 +58,14 @@ func (q *URLQueue) Push(urls []*url.URL, depth int) {
 	defer q.mu.Unlock()
 
 	for _, u := range urls {
-		// Skip if URL has been seen
-		if q.seen[u.String()] {
+		// Skip if URL is not on an in-scope host
+		if !q.scope.Contains(u) {
 			continue
 		}
 
-		// Skip if URL is not in the same domain
-		if u.Host != q.baseHost {
+		// Skip if URL has been seen
+		u = q.canonical(u)
+		if q.seen[u.String()] {
 			continue
 		}
 
@@ -57,6 +76,8 @@ func (q *URLQueue) Push(urls []*url.URL, depth int) {
 			Depth: depth,
 		})
 	}
+
+	q.cond.Broadcast()
 }
 
 // Pop removes and returns the next URL from the queue
@@ -73,6 +94,92 @@ func (q *URLQueue) Pop() *QueueItem {
 	return item
 }
 
+// Next blocks until an item is available and marks it as in flight.
+// It returns nil once the queue is empty and no items are in flight,
+// meaning the crawl is complete, or after Close has been called.
+// Every item returned by Next must be released with Done.
+func (q *URLQueue) Next() *QueueItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.queue) == 0 && len(q.inFlight) > 0 && !q.closed {
+		q.cond.Wait()
+	}
+
+	if q.closed || len(q.queue) == 0 {
+		return nil
+	}
+
+	item := q.queue[0]
+	q.queue = q.queue[1:]
+	q.inFlight[item] = true
+	return item
+}
+
+// Done marks an item returned by Next as fully processed.
+// Any URLs discovered while processing the item must be pushed before calling Done.
+func (q *URLQueue) Done(item *QueueItem) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.inFlight, item)
+	if len(q.inFlight) == 0 && len(q.queue) == 0 {
+		// Wake waiting consumers so they can observe completion
+		q.cond.Broadcast()
+	}
+}
+
+// Close wakes all waiting consumers and stops Next from returning items
+func (q *URLQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// InFlight returns the number of items currently being processed
+func (q *URLQueue) InFlight() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.inFlight)
+}
+
+// Snapshot returns the items still to be processed, including those
+// currently in flight, and all URLs seen so far
+func (q *URLQueue) Snapshot() (pending []*QueueItem, seen []string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pending = make([]*QueueItem, 0, len(q.inFlight)+len(q.queue))
+	for item := range q.inFlight {
+		pending = append(pending, item)
+	}
+	pending = append(pending, q.queue...)
+
+	seen = make([]string, 0, len(q.seen))
+	for urlStr := range q.seen {
+		seen = append(seen, urlStr)
+	}
+
+	return pending, seen
+}
+
+// Restore replaces the queue contents with previously snapshotted state
+func (q *URLQueue) Restore(pending []*QueueItem, seen []string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.queue = append(make([]*QueueItem, 0, len(pending)), pending...)
+	q.seen = make(map[string]bool, len(seen))
+	for _, urlStr := range seen {
+		q.seen[urlStr] = true
+	}
+	q.inFlight = make(map[*QueueItem]bool)
+
+	q.cond.Broadcast()
+}
+
 // Len returns the current length of the queue
 func (q *URLQueue) Len() int {
 	q.mu.Lock()
@@ -84,7 +191,34 @@ func (q *URLQueue) Len() int {
 func (q *URLQueue) HasSeen(u *url.URL) bool {
 	q.mu.Lock()
 	defer q.mu.Unlock()
-	return q.seen[u.String()]
+	return q.seen[q.canonical(u).String()]
+}
+
+// MarkSeen marks a URL as seen without queueing it
+func (q *URLQueue) MarkSeen(u *url.URL) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.seen[q.canonical(u).String()] = true
+}
+
+// SetScope sets the hosts URLs must be on to be queued
+func (q *URLQueue) SetScope(s *scope.Scope) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.scope = s
+}
+
+// canonical returns the normalized form of u used for deduplication.
+// The caller must hold q.mu.
+func (q *URLQueue) canonical(u *url.URL) *url.URL {
+	return q.scope.Canonical(q.normalizer.Normalize(u))
+}
+
+// SetNormalizer sets the normalizer applied to URLs before deduplication
+func (q *URLQueue) SetNormalizer(normalizer *urlnorm.Normalizer) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.normalizer = normalizer
 }
 
 // SeenCount returns the number of unique URLs seen
@@ -101,6 +235,7 @@ func (q *URLQueue) Clear() {
 
 	q.queue = make([]*QueueItem, 0)
 	q.seen = make(map[string]bool)
+	q.inFlight = make(map[*QueueItem]bool)
 }
 
 // GetProcessedURLs returns a slice of all processed URLs
@@ -117,7 +252,7 @@ func (q *URLQueue) GetProcessedURLs() []*url.URL {
 	return urls
 }
 
-// IsInDomain checks if a URL is in the same domain as the base URL
+// IsInDomain checks if a URL is on an in-scope host
 func (q *URLQueue) IsInDomain(u *url.URL) bool {
-	return u.Host == q.baseHost
+	return q.scope.Contains(u)
 }
@@ -0,0 +1,100 @@
+package crawler
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"path"
+	"time"
+)
+
+// retryBaseDelay is the delay before the first retry, doubled for each
+// subsequent attempt
+const retryBaseDelay = 500 * time.Millisecond
+
+// fetch processes a page, retrying network errors and 429/5xx responses
+// with jittered exponential backoff. It returns the page of the last
+// attempt and the number of attempts made.
+func (c *Crawler) fetch(ctx context.Context, item *QueueItem) (*Page, int, error) {
+	attempt := 0
+	for {
+		attempt++
+		page := NewPage(item.URL, item.Depth)
+		page.UserAgent = c.config.UserAgent
+		page.MaxBodySize = c.config.MaxBodySize
+		page.BoilerplateSelectors = c.config.BoilerplateSelectors
+		page.LastModSources = c.config.LastModSources
+		page.Cached = c.cache.Get(item.URL.String())
+
+		// Check the Content-Type of URLs without a file extension with a
+		// HEAD request first, so non-HTML resources are not downloaded
+		if attempt == 1 && c.config.SniffWithHead && page.Cached == nil && path.Ext(item.URL.Path) == "" {
+			if err := c.scheduler.Wait(ctx, item.URL.Host); err != nil {
+				return page, attempt, err
+			}
+			start := time.Now()
+			statusCode, done := page.head(ctx, c.client)
+			c.scheduler.Observe(item.URL.Host, time.Since(start), statusCode)
+			if done {
+				return page, attempt, nil
+			}
+		}
+
+		// Wait for the host's rate limit
+		if err := c.scheduler.Wait(ctx, item.URL.Host); err != nil {
+			return page, attempt, err
+		}
+
+		start := time.Now()
+		err := page.Process(ctx, c.client)
+		c.scheduler.Observe(item.URL.Host, time.Since(start), page.StatusCode)
+
+		if err == nil || attempt > c.config.MaxRetries || !isRetryable(page) {
+			return page, attempt, err
+		}
+
+		// Wait before retrying, giving up if the crawl is cancelled
+		timer := time.NewTimer(c.retryDelay(attempt, page.RetryAfter))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return page, attempt, err
+		}
+	}
+}
+
+// retryDelay returns the time to wait before retrying after the given
+// attempt, honoring a server-requested delay and capped at RetryMaxWait
+func (c *Crawler) retryDelay(attempt int, retryAfter time.Duration) time.Duration {
+	backoff := retryBaseDelay << (attempt - 1)
+	if backoff <= 0 || backoff > c.config.RetryMaxWait {
+		backoff = c.config.RetryMaxWait
+	}
+
+	// Jitter the delay within [backoff/2, backoff] to spread out retries
+	// from concurrent workers
+	delay := backoff/2 + time.Duration(rand.Int64N(int64(backoff/2)+1))
+
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	if delay > c.config.RetryMaxWait {
+		delay = c.config.RetryMaxWait
+	}
+	return delay
+}
+
+// isRetryable reports whether a failed page fetch may succeed if retried
+func isRetryable(page *Page) bool {
+	switch {
+	case page.StatusCode == 0:
+		// Network error, no response received
+		return true
+	case page.StatusCode == http.StatusTooManyRequests:
+		return true
+	case page.StatusCode >= 500:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,286 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRobotsSize is the maximum number of bytes read from a robots.txt file
+const maxRobotsSize = 500 * 1024
+
+// maxResourceRedirects is the number of redirects followed when fetching
+// robots.txt and sitemaps, the minimum required by RFC 9309
+const maxResourceRedirects = 5
+
+// RobotsRules holds the robots.txt rules that apply to the crawler's user agent
+type RobotsRules struct {
+	// rules are the Allow/Disallow rules of the matching group
+	rules []robotsRule
+
+	// CrawlDelay is the Crawl-delay of the matching group, if any
+	CrawlDelay time.Duration
+
+	// Sitemaps contains the URLs listed in Sitemap directives
+	Sitemaps []string
+}
+
+// robotsRule represents a single Allow or Disallow line
+type robotsRule struct {
+	allow   bool
+	pattern string
+	re      *regexp.Regexp
+}
+
+// robotsGroup represents a set of rules for one or more user agents
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// FetchRobots downloads and parses robots.txt for the host of baseURL.
+// Redirects are followed as far as client allows; a redirect it doesn't
+// follow is treated like a missing robots.txt.
+func FetchRobots(ctx context.Context, client *http.Client, baseURL *url.URL, userAgent string) (*RobotsRules, error) {
+	robotsURL := &url.URL{
+		Scheme: baseURL.Scheme,
+		Host:   baseURL.Host,
+		Path:   "/robots.txt",
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch robots.txt: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return ParseRobots(io.LimitReader(resp.Body, maxRobotsSize), userAgent), nil
+	case resp.StatusCode >= 300 && resp.StatusCode < 500:
+		// A missing or inaccessible robots.txt, or a redirect chain the
+		// client didn't resolve, means there are no restrictions
+		return &RobotsRules{}, nil
+	default:
+		return nil, fmt.Errorf("unexpected status code for robots.txt: %d", resp.StatusCode)
+	}
+}
+
+// ParseRobots parses a robots.txt file and returns the rules for userAgent
+func ParseRobots(r io.Reader, userAgent string) *RobotsRules {
+	var (
+		groups   []*robotsGroup
+		current  *robotsGroup
+		sitemaps []string
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Strip comments
+		if idx := strings.Index(line, "#"); idx != -1 {
+			line = line[:idx]
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// Consecutive user-agent lines share the same group
+			if current == nil || len(current.rules) > 0 || current.crawlDelay > 0 {
+				current = &robotsGroup{}
+				groups = append(groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			if current == nil || value == "" {
+				continue
+			}
+			current.rules = append(current.rules, robotsRule{
+				allow:   key == "allow",
+				pattern: value,
+				re:      compileRobotsPattern(value),
+			})
+		case "crawl-delay":
+			if current == nil {
+				continue
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				current.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		case "sitemap":
+			if value != "" {
+				sitemaps = append(sitemaps, value)
+			}
+		}
+	}
+
+	rules := &RobotsRules{Sitemaps: sitemaps}
+	for _, g := range matchRobotsGroups(groups, userAgent) {
+		rules.rules = append(rules.rules, g.rules...)
+		if g.crawlDelay > rules.CrawlDelay {
+			rules.CrawlDelay = g.crawlDelay
+		}
+	}
+
+	return rules
+}
+
+// matchRobotsGroups returns the groups that apply to userAgent.
+// Groups naming our product token (matched case-insensitively) win;
+// otherwise the wildcard groups apply. Matching groups are merged.
+func matchRobotsGroups(groups []*robotsGroup, userAgent string) []*robotsGroup {
+	token := robotsProductToken(userAgent)
+
+	var matched, wildcard []*robotsGroup
+	for _, g := range groups {
+		named, isWildcard := false, false
+		for _, agent := range g.agents {
+			if agent == "*" {
+				isWildcard = true
+			} else if token != "" && strings.EqualFold(agent, token) {
+				named = true
+			}
+		}
+
+		switch {
+		case named:
+			matched = append(matched, g)
+		case isWildcard:
+			wildcard = append(wildcard, g)
+		}
+	}
+
+	if len(matched) > 0 {
+		return matched
+	}
+	return wildcard
+}
+
+// robotsProductToken extracts the lowercased product token from a User-Agent
+// string, e.g. "mapper" from "Mapper/1.0 (+https://github.com/ncecere/mapper)"
+func robotsProductToken(userAgent string) string {
+	token := strings.TrimSpace(userAgent)
+	if idx := strings.IndexAny(token, "/ "); idx != -1 {
+		token = token[:idx]
+	}
+	return strings.ToLower(token)
+}
+
+// compileRobotsPattern converts a robots.txt path pattern into a regex,
+// supporting the * wildcard and the $ end anchor
+func compileRobotsPattern(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")
+	if anchored {
+		expr += "$"
+	}
+
+	return regexp.MustCompile(expr)
+}
+
+// IsAllowed reports whether the URL may be crawled.
+// The longest matching rule wins, with Allow preferred on ties.
+func (r *RobotsRules) IsAllowed(u *url.URL) bool {
+	if r == nil || len(r.rules) == 0 {
+		return true
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	// robots.txt itself is always allowed
+	if path == "/robots.txt" {
+		return true
+	}
+
+	allowed := true
+	longest := -1
+	for _, rule := range r.rules {
+		if !rule.re.MatchString(path) {
+			continue
+		}
+		length := len(rule.pattern)
+		if length > longest || (length == longest && rule.allow) {
+			longest = length
+			allowed = rule.allow
+		}
+	}
+
+	return allowed
+}
+
+// robotsEntry holds the outcome of fetching a host's robots.txt
+type robotsEntry struct {
+	once  sync.Once
+	rules *RobotsRules
+	err   error
+}
+
+// loadRobots returns the robots.txt rules of the host of u, fetching them
+// the first time the host is seen. If robots.txt should be respected, the
+// rules and Crawl-delay are applied to the host; a host whose robots.txt
+// cannot be loaded is not crawled.
+func (c *Crawler) loadRobots(ctx context.Context, u *url.URL) (*RobotsRules, error) {
+	c.robotsMu.Lock()
+	entry, ok := c.robots[u.Host]
+	if !ok {
+		entry = &robotsEntry{}
+		c.robots[u.Host] = entry
+	}
+	c.robotsMu.Unlock()
+
+	entry.once.Do(func() {
+		entry.rules, entry.err = FetchRobots(ctx, c.resourceClient, u, c.config.UserAgent)
+		if !c.config.RespectRobots || ctx.Err() != nil {
+			return
+		}
+
+		rules := entry.rules
+		if entry.err != nil {
+			c.setErr(fmt.Errorf("failed to load robots.txt for %s: %w", u.Host, entry.err))
+			rules = disallowAll()
+		}
+		c.validator.SetRobots(u.Host, rules)
+
+		// Honor Crawl-delay if it is stricter than the configured rate limit
+		c.scheduler.SetMinInterval(u.Host, rules.CrawlDelay)
+	})
+
+	return entry.rules, entry.err
+}
+
+// disallowAll returns rules that disallow every URL
+func disallowAll() *RobotsRules {
+	return &RobotsRules{
+		rules: []robotsRule{{allow: false, pattern: "/", re: compileRobotsPattern("/")}},
+	}
+}
@@ -0,0 +1,200 @@
+package crawler
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testUserAgent = "Mapper/1.0 (+https://github.com/ncecere/mapper)"
+
+func TestRobotsIsAllowed(t *testing.T) {
+	tests := []struct {
+		name   string
+		robots string
+		path   string
+		want   bool
+	}{
+		{"no rules", "", "/a", true},
+		{"disallowed prefix", "User-agent: *\nDisallow: /private", "/private/a", false},
+		{"plain prefix match", "User-agent: *\nDisallow: /private", "/privateer", false},
+		{"other path", "User-agent: *\nDisallow: /private", "/public", true},
+		{"empty disallow allows all", "User-agent: *\nDisallow:", "/a", true},
+		{"disallow all", "User-agent: *\nDisallow: /", "/a", false},
+		{"robots.txt always allowed", "User-agent: *\nDisallow: /", "/robots.txt", true},
+
+		// The longest matching rule wins; Allow wins ties
+		{"longer allow wins", "User-agent: *\nDisallow: /a\nAllow: /a/b", "/a/b/c", true},
+		{"longer disallow wins", "User-agent: *\nAllow: /a\nDisallow: /a/b", "/a/b/c", false},
+		{"shorter rule applies elsewhere", "User-agent: *\nDisallow: /a\nAllow: /a/b", "/a/c", false},
+		{"allow wins a tie", "User-agent: *\nDisallow: /a\nAllow: /a", "/a", true},
+		{"order doesn't matter", "User-agent: *\nAllow: /a/b\nDisallow: /a", "/a/b", true},
+
+		// Wildcards and the end anchor
+		{"wildcard", "User-agent: *\nDisallow: /*/edit", "/posts/1/edit", false},
+		{"wildcard without match", "User-agent: *\nDisallow: /*/edit", "/edit", true},
+		{"anchored suffix", "User-agent: *\nDisallow: /*.pdf$", "/files/a.pdf", false},
+		{"anchored suffix with query", "User-agent: *\nDisallow: /*.pdf$", "/files/a.pdf?x=1", true},
+		{"anchored suffix not at end", "User-agent: *\nDisallow: /*.pdf$", "/files/a.pdf/view", true},
+		{"unanchored suffix", "User-agent: *\nDisallow: /*.pdf", "/files/a.pdf/view", false},
+		{"anchored exact path", "User-agent: *\nDisallow: /$", "/", false},
+		{"anchored exact path elsewhere", "User-agent: *\nDisallow: /$", "/a", true},
+		{"dollar inside a pattern", "User-agent: *\nDisallow: /a$b", "/a$b", false},
+		{"regex characters are literal", "User-agent: *\nDisallow: /a.b", "/axb", true},
+		{"query string", "User-agent: *\nDisallow: /*?sort=", "/list?sort=asc", false},
+
+		// Comments and formatting
+		{"comments", "# comment\nUser-agent: * # all\nDisallow: /a # private", "/a", false},
+		{"case-insensitive keys", "USER-AGENT: *\nDISALLOW: /a", "/a", false},
+		{"rules before any group are ignored", "Disallow: /a\nUser-agent: *\nAllow: /", "/a", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := ParseRobots(strings.NewReader(tt.robots), testUserAgent)
+			u, err := url.Parse("https://example.com" + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := rules.IsAllowed(u); got != tt.want {
+				t.Errorf("IsAllowed(%s) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRobotsGroupMatching(t *testing.T) {
+	tests := []struct {
+		name   string
+		robots string
+		path   string
+		want   bool
+	}{
+		{"wildcard group", "User-agent: *\nDisallow: /a", "/a", false},
+		{"named group replaces wildcard", "User-agent: *\nDisallow: /a\n\nUser-agent: mapper\nDisallow: /b", "/a", true},
+		{"named group applies", "User-agent: *\nDisallow: /a\n\nUser-agent: mapper\nDisallow: /b", "/b", false},
+		{"name is case-insensitive", "User-agent: *\nDisallow: /a\n\nUser-agent: MAPPER\nDisallow: /b", "/a", true},
+		{"prefix of our name doesn't match", "User-agent: map\nDisallow: /a", "/a", true},
+		{"longer name doesn't match", "User-agent: mapperbot\nDisallow: /a", "/a", true},
+		{"other agent", "User-agent: googlebot\nDisallow: /a", "/a", true},
+		{"shared group", "User-agent: googlebot\nUser-agent: mapper\nDisallow: /a", "/a", false},
+		{"named groups are merged", "User-agent: mapper\nDisallow: /a\n\nUser-agent: mapper\nDisallow: /b", "/a", false},
+		{"wildcard groups are merged", "User-agent: *\nDisallow: /a\n\nUser-agent: *\nDisallow: /b", "/b", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := ParseRobots(strings.NewReader(tt.robots), testUserAgent)
+			u, _ := url.Parse("https://example.com" + tt.path)
+			if got := rules.IsAllowed(u); got != tt.want {
+				t.Errorf("IsAllowed(%s) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRobotsDirectives(t *testing.T) {
+	robots := "Sitemap: https://example.com/a.xml\n" +
+		"User-agent: *\nCrawl-delay: 2\nDisallow: /a\n\n" +
+		"User-agent: mapper\nCrawl-delay: 0.5\nDisallow: /b\n" +
+		"Sitemap: https://example.com/b.xml\n"
+
+	rules := ParseRobots(strings.NewReader(robots), testUserAgent)
+	if rules.CrawlDelay != 500*time.Millisecond {
+		t.Errorf("CrawlDelay = %v, want 500ms", rules.CrawlDelay)
+	}
+	if len(rules.Sitemaps) != 2 {
+		t.Errorf("Sitemaps = %v, want 2 entries", rules.Sitemaps)
+	}
+}
+
+func TestRobotsProductToken(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      string
+	}{
+		{testUserAgent, "mapper"},
+		{"Mapper", "mapper"},
+		{"  MyBot/2.0", "mybot"},
+		{"Mozilla/5.0 (compatible; Foo)", "mozilla"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := robotsProductToken(tt.userAgent); got != tt.want {
+			t.Errorf("robotsProductToken(%q) = %q, want %q", tt.userAgent, got, tt.want)
+		}
+	}
+}
+
+func TestFetchRobots(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Host {
+		case "ok.test":
+			w.Write([]byte("User-agent: *\nDisallow: /a"))
+		case "missing.test":
+			http.NotFound(w, r)
+		case "error.test":
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		case "redirect.test":
+			http.Redirect(w, r, "/robots-new.txt", http.StatusMovedPermanently)
+		}
+	})
+	mux.HandleFunc("/robots-new.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("User-agent: *\nDisallow: /a"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Send every request to the test server, whatever its host
+	following := server.Client()
+	transport := following.Transport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+	}
+	following.Transport = transport
+	notFollowing := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	tests := []struct {
+		name       string
+		client     *http.Client
+		host       string
+		wantErr    bool
+		wantDenied bool
+	}{
+		{"rules", following, "ok.test", false, true},
+		{"missing", following, "missing.test", false, false},
+		{"server error", following, "error.test", true, false},
+		{"followed redirect", following, "redirect.test", false, true},
+		{"unresolved redirect", notFollowing, "redirect.test", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseURL := &url.URL{Scheme: "http", Host: tt.host, Path: "/"}
+			rules, err := FetchRobots(context.Background(), tt.client, baseURL, testUserAgent)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FetchRobots() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			u := &url.URL{Scheme: "http", Host: tt.host, Path: "/a"}
+			if denied := !rules.IsAllowed(u); denied != tt.wantDenied {
+				t.Errorf("/a denied = %v, want %v", denied, tt.wantDenied)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// minAdaptiveInterval is the interval adaptive mode starts slowing down
+	// from when no rate limit is configured
+	minAdaptiveInterval = 100 * time.Millisecond
+
+	// maxAdaptiveInterval is the slowest rate adaptive mode backs off to
+	maxAdaptiveInterval = 30 * time.Second
+
+	// latencyThreshold is the factor by which the average response latency
+	// may exceed the baseline before adaptive mode slows down
+	latencyThreshold = 2.0
+
+	// latencySmoothing is the weight of a new sample in the latency average
+	latencySmoothing = 0.2
+
+	// baselineDrift is the weight of the latency average in the baseline
+	baselineDrift = 0.01
+
+	// adjustCooldown is the minimum time between adjustments of a host's
+	// interval, so concurrent responses don't compound a single change
+	adjustCooldown = time.Second
+)
+
+// Scheduler enforces a request rate per host that is shared by all workers,
+// using a token bucket that allows short bursts
+type Scheduler struct {
+	mu sync.Mutex
+
+	// interval is the configured minimum time between requests to a host
+	interval time.Duration
+
+	// burst is the number of requests that may be made back to back
+	burst int
+
+	// adaptive adjusts each host's interval to its observed health
+	adaptive bool
+
+	// hosts holds the bucket of each host seen so far
+	hosts map[string]*hostBucket
+}
+
+// hostBucket is the token bucket of a single host
+type hostBucket struct {
+	// tokens available; negative when requests are waiting for a token
+	tokens float64
+
+	// last is the time tokens were last refilled
+	last time.Time
+
+	// burst is the number of requests that may be made back to back
+	burst int
+
+	// interval is the current time between requests, which adaptive mode
+	// raises above the configured interval when the host is struggling
+	interval time.Duration
+
+	// minInterval is the host's own minimum time between requests, e.g.
+	// its robots.txt Crawl-delay, if stricter than the configured interval
+	minInterval time.Duration
+
+	// latency is the moving average response latency
+	latency time.Duration
+
+	// baseline is the typical healthy latency; it follows the lowest
+	// average latency observed and drifts slowly towards the current one
+	baseline time.Duration
+
+	// adjusted is the time interval was last adjusted
+	adjusted time.Time
+}
+
+// NewScheduler creates a new Scheduler allowing one request per interval
+// and bursts of up to burst requests per host
+func NewScheduler(interval time.Duration, burst int, adaptive bool) *Scheduler {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Scheduler{
+		interval: interval,
+		burst:    burst,
+		adaptive: adaptive,
+		hosts:    make(map[string]*hostBucket),
+	}
+}
+
+// Wait blocks until a request to host may be made or ctx is cancelled
+func (s *Scheduler) Wait(ctx context.Context, host string) error {
+	delay := s.reserve(host)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token from the host's bucket and returns how long the
+// caller must wait for it to become available
+func (s *Scheduler) reserve(host string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.bucket(host)
+	if b.interval <= 0 {
+		return 0
+	}
+
+	// Refill tokens for the time elapsed since the last reservation
+	now := time.Now()
+	b.tokens += float64(now.Sub(b.last)) / float64(b.interval)
+	if b.tokens > float64(b.burst) {
+		b.tokens = float64(b.burst)
+	}
+	b.last = now
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens * float64(b.interval))
+}
+
+// Observe records the outcome of a request to host. In adaptive mode the
+// host is slowed down when it responds with 429/503 or its latency rises
+// well above its baseline, and sped back up while it is healthy.
+func (s *Scheduler) Observe(host string, latency time.Duration, statusCode int) {
+	// Requests that got no response, e.g. because they were cancelled,
+	// say nothing about the host's health
+	if !s.adaptive || statusCode == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.bucket(host)
+
+	// Track the moving average latency of successful responses
+	if statusCode > 0 && statusCode < 500 && statusCode != http.StatusTooManyRequests {
+		if b.latency == 0 {
+			b.latency = latency
+		} else {
+			b.latency += time.Duration(latencySmoothing * float64(latency-b.latency))
+		}
+		if b.baseline == 0 || b.latency < b.baseline {
+			b.baseline = b.latency
+		} else {
+			b.baseline += time.Duration(baselineDrift * float64(b.latency-b.baseline))
+		}
+	}
+
+	now := time.Now()
+	if now.Sub(b.adjusted) < adjustCooldown {
+		return
+	}
+	b.adjusted = now
+
+	overloaded := statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable
+	slow := b.baseline > 0 && float64(b.latency) > latencyThreshold*float64(b.baseline)
+
+	switch {
+	case overloaded:
+		b.interval = s.slowDown(b.interval, 2)
+	case slow:
+		b.interval = s.slowDown(b.interval, 1.5)
+	default:
+		b.interval = s.speedUp(b.interval, b.minInterval)
+	}
+}
+
+// Interval returns the current time between requests to host
+func (s *Scheduler) Interval(host string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bucket(host).interval
+}
+
+// SetMinInterval sets the minimum time between requests to host, e.g. from
+// its Crawl-delay. It only takes effect if stricter than the configured
+// interval, in which case the host gets no bursts either.
+func (s *Scheduler) SetMinInterval(host string, interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.bucket(host)
+	b.minInterval = interval
+	if interval > s.interval {
+		b.burst = 1
+		b.tokens = min(b.tokens, 1)
+	}
+	if b.interval < interval {
+		b.interval = interval
+	}
+}
+
+// slowDown multiplies an interval by factor, up to maxAdaptiveInterval
+func (s *Scheduler) slowDown(interval time.Duration, factor float64) time.Duration {
+	if interval < minAdaptiveInterval {
+		interval = minAdaptiveInterval
+	}
+	interval = time.Duration(float64(interval) * factor)
+	if interval > maxAdaptiveInterval {
+		interval = maxAdaptiveInterval
+	}
+	return interval
+}
+
+// speedUp reduces an interval by 10%, down to the configured interval or
+// the host's minimum interval, whichever is larger
+func (s *Scheduler) speedUp(interval, minInterval time.Duration) time.Duration {
+	floor := max(s.interval, minInterval)
+	interval = time.Duration(float64(interval) * 0.9)
+	if interval < floor || interval < minAdaptiveInterval {
+		interval = floor
+	}
+	return interval
+}
+
+// bucket returns the bucket for host, creating a full one if needed.
+// The caller must hold s.mu.
+func (s *Scheduler) bucket(host string) *hostBucket {
+	b, ok := s.hosts[host]
+	if !ok {
+		b = &hostBucket{
+			tokens:   float64(s.burst),
+			last:     time.Now(),
+			burst:    s.burst,
+			interval: s.interval,
+		}
+		s.hosts[host] = b
+	}
+	return b
+}
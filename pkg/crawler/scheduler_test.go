@@ -0,0 +1,40 @@
+package crawler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedulerBurst(t *testing.T) {
+	tests := []struct {
+		name        string
+		interval    time.Duration
+		burst       int
+		minInterval time.Duration
+		wantFree    int
+	}{
+		{"no rate limit", 0, 1, 0, 10},
+		{"single request", time.Hour, 1, 0, 1},
+		{"burst", time.Hour, 5, 0, 5},
+		{"laxer crawl delay keeps the burst", time.Hour, 5, time.Minute, 5},
+		{"stricter crawl delay disables the burst", time.Minute, 5, time.Hour, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewScheduler(tt.interval, tt.burst, false)
+			if tt.minInterval > 0 {
+				s.SetMinInterval("example.com", tt.minInterval)
+			}
+
+			// Count the requests allowed back to back
+			free := 0
+			for i := 0; i < 10 && s.reserve("example.com") == 0; i++ {
+				free++
+			}
+			if free != tt.wantFree {
+				t.Errorf("%d requests allowed back to back, want %d", free, tt.wantFree)
+			}
+		})
+	}
+}
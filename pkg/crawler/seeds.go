@@ -0,0 +1,114 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// maxSeedSitemaps is the maximum number of sitemaps fetched for seeding
+	maxSeedSitemaps = 1000
+
+	// maxSeedSitemapSize is the maximum number of bytes read from a sitemap
+	maxSeedSitemapSize = 50 * 1024 * 1024
+)
+
+// sitemapDocument matches both <urlset> and <sitemapindex> documents
+type sitemapDocument struct {
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+// sitemapLoc is a <url> or <sitemap> entry
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+// DiscoverSitemapURLs fetches the sitemap at /sitemap.xml and any sitemaps
+// listed in robots.txt, following sitemap indexes, and returns every page
+// URL they list
+func DiscoverSitemapURLs(ctx context.Context, client *http.Client, baseURL *url.URL, userAgent string, robots *RobotsRules) []*url.URL {
+	pending := []string{
+		(&url.URL{Scheme: baseURL.Scheme, Host: baseURL.Host, Path: "/sitemap.xml"}).String(),
+	}
+	if robots != nil {
+		pending = append(pending, robots.Sitemaps...)
+	}
+
+	visited := make(map[string]bool)
+	var seeds []*url.URL
+	for len(pending) > 0 && len(visited) < maxSeedSitemaps && ctx.Err() == nil {
+		sitemapURL := pending[0]
+		pending = pending[1:]
+
+		if visited[sitemapURL] {
+			continue
+		}
+		visited[sitemapURL] = true
+
+		// Sitemaps that are missing or malformed are skipped
+		doc, err := fetchSitemap(ctx, client, sitemapURL, userAgent)
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range doc.Sitemaps {
+			pending = append(pending, strings.TrimSpace(entry.Loc))
+		}
+
+		for _, entry := range doc.URLs {
+			if u, err := url.Parse(strings.TrimSpace(entry.Loc)); err == nil && u.IsAbs() {
+				seeds = append(seeds, u)
+			}
+		}
+	}
+
+	return uniqueURLs(seeds)
+}
+
+// fetchSitemap downloads and parses a sitemap or sitemap index,
+// transparently decompressing gzipped files
+func fetchSitemap(ctx context.Context, client *http.Client, sitemapURL, userAgent string) (*sitemapDocument, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sitemapURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch sitemap: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	// Detect gzip by its magic number, as .gz sitemaps are usually served
+	// without a Content-Encoding header
+	var body io.Reader = bufio.NewReader(resp.Body)
+	if magic, err := body.(*bufio.Reader).Peek(2); err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress sitemap: %w", err)
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	var doc sitemapDocument
+	if err := xml.NewDecoder(io.LimitReader(body, maxSeedSitemapSize)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse sitemap: %w", err)
+	}
+
+	return &doc, nil
+}
@@ -1,9 +1,14 @@
 package crawler
 
 import (
+	"errors"
 	"net/url"
-	"regexp"
+	"path"
 	"strings"
+	"sync"
+
+	"github.com/ncecere/mapper/pkg/scope"
+	"github.com/ncecere/mapper/pkg/urlpattern"
 )
 
 // URLValidator handles URL validation and filtering
@@ -11,37 +16,48 @@ type URLValidator struct {
 	// baseURL is the starting point URL
 	baseURL *url.URL
 
-	// excludePatterns contains compiled regex patterns for URLs to exclude
-	excludePatterns []*regexp.Regexp
+	// excludePatterns contains compiled patterns for URLs to exclude
+	excludePatterns []urlpattern.Pattern
+
+	// includePatterns contains compiled patterns for URLs to include
+	includePatterns []urlpattern.Pattern
+
+	// scope holds the hosts URLs must be on
+	scope *scope.Scope
+
+	// scopePrefixes are the path prefixes URLs must be under to be listed
+	scopePrefixes []string
+
+	// passThrough are paths outside scopePrefixes that may still be crawled
+	passThrough []string
+
+	// skipExtensions are the file extensions of non-content URLs to skip
+	skipExtensions map[string]bool
+
+	// listExtensions are the file extensions of resources that are listed
+	// but not parsed, overriding skipExtensions
+	listExtensions map[string]bool
 
-	// includePatterns contains compiled regex patterns for URLs to include
-	includePatterns []*regexp.Regexp
+	// robots holds the robots.txt rules of each host, if they should be respected
+	robotsMu sync.RWMutex
+	robots   map[string]*RobotsRules
 }
 
 // NewURLValidator creates a new URLValidator instance
 func NewURLValidator(baseURL *url.URL, excludePatterns, includePatterns []string) (*URLValidator, error) {
 	v := &URLValidator{
-		baseURL:         baseURL,
-		excludePatterns: make([]*regexp.Regexp, 0, len(excludePatterns)),
-		includePatterns: make([]*regexp.Regexp, 0, len(includePatterns)),
+		baseURL: baseURL,
+		scope:   scope.Exact(baseURL),
+		robots:  make(map[string]*RobotsRules),
 	}
-
-	// Compile exclude patterns
-	for _, pattern := range excludePatterns {
-		re, err := regexp.Compile(pattern)
-		if err != nil {
-			return nil, err
-		}
-		v.excludePatterns = append(v.excludePatterns, re)
-	}
-
-	// Compile include patterns
-	for _, pattern := range includePatterns {
-		re, err := regexp.Compile(pattern)
-		if err != nil {
-			return nil, err
-		}
-		v.includePatterns = append(v.includePatterns, re)
+	v.SetExtensions(DefaultSkipExtensions, nil)
+
+	// Compile exclude and include patterns, reporting every invalid one
+	var excludeErr, includeErr error
+	v.excludePatterns, excludeErr = urlpattern.CompileAll("exclude", excludePatterns)
+	v.includePatterns, includeErr = urlpattern.CompileAll("include", includePatterns)
+	if err := errors.Join(excludeErr, includeErr); err != nil {
+		return nil, err
 	}
 
 	return v, nil
@@ -59,8 +75,13 @@ func (v *URLValidator) IsValid(u *url.URL) bool {
 		return false
 	}
 
-	// Skip URLs not in the same domain
-	if u.Host != v.baseURL.Host {
+	// Skip URLs not on an in-scope host
+	if !v.scope.Contains(u) {
+		return false
+	}
+
+	// Skip URLs outside the path prefixes that aren't passed through
+	if !v.InPathScope(u) && !v.IsPassThrough(u) {
 		return false
 	}
 
@@ -69,10 +90,17 @@ func (v *URLValidator) IsValid(u *url.URL) bool {
 		return false
 	}
 
+	// Skip URLs disallowed by robots.txt
+	v.robotsMu.RLock()
+	robots := v.robots[u.Host]
+	v.robotsMu.RUnlock()
+	if !robots.IsAllowed(u) {
+		return false
+	}
+
 	// Check against exclude patterns
-	urlStr := u.String()
 	for _, pattern := range v.excludePatterns {
-		if pattern.MatchString(urlStr) {
+		if pattern.Match(u) {
 			return false
 		}
 	}
@@ -81,7 +109,7 @@ func (v *URLValidator) IsValid(u *url.URL) bool {
 	if len(v.includePatterns) > 0 {
 		matched := false
 		for _, pattern := range v.includePatterns {
-			if pattern.MatchString(urlStr) {
+			if pattern.Match(u) {
 				matched = true
 				break
 			}
@@ -94,27 +122,98 @@ func (v *URLValidator) IsValid(u *url.URL) bool {
 	return true
 }
 
-// isNonContentFile checks if the URL points to a non-HTML resource
-func (v *URLValidator) isNonContentFile(path string) bool {
-	// List of file extensions to skip
-	nonContentExts := []string{
-		".jpg", ".jpeg", ".png", ".gif", ".ico", ".css", ".js",
-		".pdf", ".doc", ".docx", ".ppt", ".pptx", ".xls", ".xlsx",
-		".zip", ".tar", ".gz", ".rar", ".exe", ".mp3", ".mp4",
-		".avi", ".mov", ".wmv", ".flv", ".svg", ".woff", ".woff2",
-		".ttf", ".eot",
-	}
-
-	path = strings.ToLower(path)
-	for _, ext := range nonContentExts {
-		if strings.HasSuffix(path, ext) {
+// SetRobots sets the robots.txt rules URLs on host are checked against
+func (v *URLValidator) SetRobots(host string, robots *RobotsRules) {
+	v.robotsMu.Lock()
+	defer v.robotsMu.Unlock()
+	v.robots[host] = robots
+}
+
+// SetScope sets the hosts URLs must be on
+func (v *URLValidator) SetScope(s *scope.Scope) {
+	v.scope = s
+}
+
+// SetPathScope restricts URLs to the given path prefixes, except for the
+// pass-through paths and the base URL, which are crawled but not listed
+func (v *URLValidator) SetPathScope(prefixes, passThrough []string) {
+	v.scopePrefixes = prefixes
+	v.passThrough = passThrough
+	if !v.InPathScope(v.baseURL) {
+		v.passThrough = append(v.passThrough, v.baseURL.Path)
+	}
+}
+
+// InPathScope reports whether the path of u is under one of the scope
+// prefixes, or whether no prefixes are configured
+func (v *URLValidator) InPathScope(u *url.URL) bool {
+	if len(v.scopePrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range v.scopePrefixes {
+		if v.IsSubpath(prefix, u.Path) {
 			return true
 		}
 	}
+	return false
+}
 
+// IsPassThrough reports whether u is outside the path scope but should be
+// crawled for link discovery
+func (v *URLValidator) IsPassThrough(u *url.URL) bool {
+	path := v.NormalizePath(u.Path)
+	for _, pattern := range v.passThrough {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(u.Path, prefix) {
+				return true
+			}
+		} else if path == v.NormalizePath(pattern) {
+			return true
+		}
+	}
 	return false
 }
 
+// SetExtensions sets the file extensions of URLs to skip and of resources
+// to list without parsing. Extensions are matched case-insensitively, with
+// or without a leading dot.
+func (v *URLValidator) SetExtensions(skip, list []string) {
+	v.skipExtensions = extensionSet(skip)
+	v.listExtensions = extensionSet(list)
+}
+
+// IsListOnly reports whether u is a resource that is listed but not parsed
+func (v *URLValidator) IsListOnly(u *url.URL) bool {
+	return v.listExtensions[fileExtension(u.Path)]
+}
+
+// isNonContentFile checks if the URL points to a non-HTML resource
+func (v *URLValidator) isNonContentFile(path string) bool {
+	ext := fileExtension(path)
+	return v.skipExtensions[ext] && !v.listExtensions[ext]
+}
+
+// extensionSet builds a set of lowercased extensions with a leading dot
+func extensionSet(extensions []string) map[string]bool {
+	set := make(map[string]bool, len(extensions))
+	for _, ext := range extensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		set[ext] = true
+	}
+	return set
+}
+
+// fileExtension returns the lowercased extension of the last segment of a path
+func fileExtension(p string) string {
+	return strings.ToLower(path.Ext(p))
+}
+
 // NormalizePath ensures consistent path formatting
 func (v *URLValidator) NormalizePath(path string) string {
 	// Remove trailing slash unless it's the root path
@@ -132,8 +231,8 @@ func (v *URLValidator) NormalizePath(path string) string {
 
 // ShouldFollowRedirect determines if a redirect should be followed
 func (v *URLValidator) ShouldFollowRedirect(redirectURL *url.URL) bool {
-	// Only follow redirects to the same domain
-	return redirectURL.Host == v.baseURL.Host
+	// Only follow redirects to URLs that would be crawled themselves
+	return v.IsValid(redirectURL)
 }
 
 // GetDomain returns the domain being crawled
@@ -141,9 +240,10 @@ func (v *URLValidator) GetDomain() string {
 	return v.baseURL.Host
 }
 
-// IsSubpath checks if a URL path is a subpath of another
+// IsSubpath checks if a URL path is a subpath of another, matching whole
+// path segments so that /docs does not contain /docs-old
 func (v *URLValidator) IsSubpath(parent, child string) bool {
 	parent = v.NormalizePath(parent)
 	child = v.NormalizePath(child)
-	return strings.HasPrefix(child, parent)
+	return parent == "/" || child == parent || strings.HasPrefix(child, parent+"/")
 }
@@ -0,0 +1,147 @@
+// Package scope decides which hosts belong to a crawl, so that related hosts
+// such as www.example.com and blog.example.com can be crawled together.
+package scope
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Scope modes
+const (
+	// ModeHost limits the scope to the base host, its aliases and any
+	// explicitly allowed hosts
+	ModeHost = "host"
+
+	// ModeDomain extends the scope to the registrable domain of the base
+	// host and all of its subdomains, e.g. example.com and *.example.com
+	ModeDomain = "domain"
+)
+
+// Scope is the set of hosts a crawl may visit and list
+type Scope struct {
+	// scheme is the scheme of the base URL; http and https variants of
+	// URLs on the primary host and its aliases are treated as one by using
+	// this scheme
+	scheme string
+
+	// host is the primary host, i.e. the host of the base URL
+	host string
+
+	// aliases are hosts serving the same site as the primary host
+	aliases map[string]bool
+
+	// hosts are additional hosts that are in scope
+	hosts map[string]bool
+
+	// domains are domains whose subdomains are all in scope
+	domains []string
+}
+
+// New creates a Scope for a crawl of baseURL. Aliases are hosts serving the
+// same site as the base host; their URLs are listed under the base host.
+// Hosts are additional hosts to include, where *.example.com includes
+// example.com and all of its subdomains.
+func New(baseURL *url.URL, mode string, aliases, hosts []string) (*Scope, error) {
+	s := Exact(baseURL)
+
+	switch mode {
+	case ModeHost, "":
+	case ModeDomain:
+		domain, err := registrableDomain(baseURL.Hostname())
+		if err != nil {
+			return nil, err
+		}
+		s.domains = append(s.domains, domain)
+	default:
+		return nil, fmt.Errorf("invalid scope %q: must be %s or %s", mode, ModeHost, ModeDomain)
+	}
+
+	for _, alias := range aliases {
+		if alias = strings.ToLower(strings.TrimSpace(alias)); alias != "" {
+			s.aliases[alias] = true
+		}
+	}
+
+	for _, host := range hosts {
+		host = strings.ToLower(strings.TrimSpace(host))
+		switch {
+		case strings.HasPrefix(host, "*."):
+			s.domains = append(s.domains, strings.TrimPrefix(host, "*."))
+		case host != "":
+			s.hosts[host] = true
+		}
+	}
+
+	return s, nil
+}
+
+// Exact creates a Scope containing only the host of baseURL
+func Exact(baseURL *url.URL) *Scope {
+	return &Scope{
+		scheme:  strings.ToLower(baseURL.Scheme),
+		host:    strings.ToLower(baseURL.Host),
+		aliases: make(map[string]bool),
+		hosts:   make(map[string]bool),
+	}
+}
+
+// Contains reports whether u is on an in-scope host
+func (s *Scope) Contains(u *url.URL) bool {
+	if u == nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+
+	host := strings.ToLower(u.Host)
+	if host == s.host || s.aliases[host] || s.hosts[host] {
+		return true
+	}
+
+	hostname := strings.ToLower(u.Hostname())
+	for _, domain := range s.domains {
+		if hostname == domain || strings.HasSuffix(hostname, "."+domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Canonical returns u with alias hosts replaced by the primary host, so each
+// in-scope page has a single URL. URLs on the primary host and its aliases
+// also get the scheme of the base URL; other hosts keep their own scheme, as
+// they may not serve the base URL's. URLs outside the scope are returned
+// unchanged.
+func (s *Scope) Canonical(u *url.URL) *url.URL {
+	if !s.Contains(u) {
+		return u
+	}
+
+	host := strings.ToLower(u.Host)
+	if host != s.host && !s.aliases[host] {
+		return u
+	}
+
+	canonical := *u
+	canonical.Scheme = s.scheme
+	canonical.Host = s.host
+	return &canonical
+}
+
+// registrableDomain returns the domain one label below the public suffix
+// of hostname, e.g. example.co.uk for www.example.co.uk
+func registrableDomain(hostname string) (string, error) {
+	if net.ParseIP(hostname) != nil {
+		return "", fmt.Errorf("domain scope requires a domain name, not an IP address")
+	}
+
+	domain, err := publicsuffix.EffectiveTLDPlusOne(strings.ToLower(hostname))
+	if err != nil {
+		return "", fmt.Errorf("failed to determine registrable domain of %s: %w", hostname, err)
+	}
+	return domain, nil
+}
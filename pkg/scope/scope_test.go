@@ -0,0 +1,114 @@
+package scope
+
+import (
+	"net/url"
+	"testing"
+)
+
+func mustParse(t *testing.T, rawURL string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("url.Parse(%q) error = %v", rawURL, err)
+	}
+	return u
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseURL string
+		mode    string
+		wantErr bool
+	}{
+		{"default mode", "https://example.com/", "", false},
+		{"host mode", "https://example.com/", ModeHost, false},
+		{"domain mode", "https://www.example.co.uk/", ModeDomain, false},
+		{"domain mode with IP", "http://127.0.0.1:8080/", ModeDomain, true},
+		{"invalid mode", "https://example.com/", "subdomain", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(mustParse(t, tt.baseURL), tt.mode, nil, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestContains(t *testing.T) {
+	base := mustParse(t, "https://www.example.com/")
+	hostScope, err := New(base, ModeHost, []string{"example.com"}, []string{"cdn.example.net", "*.example.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	domainScope, err := New(base, ModeDomain, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		scope *Scope
+		url   string
+		want  bool
+	}{
+		{"primary host", hostScope, "https://www.example.com/a", true},
+		{"primary host over http", hostScope, "http://www.example.com/a", true},
+		{"host case is ignored", hostScope, "https://WWW.Example.com/a", true},
+		{"alias", hostScope, "https://example.com/a", true},
+		{"allowed host", hostScope, "https://cdn.example.net/a", true},
+		{"wildcard domain itself", hostScope, "https://example.org/", true},
+		{"wildcard subdomain", hostScope, "https://a.b.example.org/", true},
+		{"suffix that isn't a subdomain", hostScope, "https://badexample.org/", false},
+		{"subdomain in host mode", hostScope, "https://blog.example.com/", false},
+		{"other port", hostScope, "https://www.example.com:8443/", false},
+		{"unsupported scheme", hostScope, "ftp://www.example.com/", false},
+		{"registrable domain", domainScope, "https://example.com/", true},
+		{"subdomain in domain mode", domainScope, "https://blog.example.com/", true},
+		{"other domain", domainScope, "https://example.net/", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.scope.Contains(mustParse(t, tt.url)); got != tt.want {
+				t.Errorf("Contains(%s) = %v, want %v", tt.url, got, tt.want)
+			}
+		})
+	}
+
+	if hostScope.Contains(nil) {
+		t.Error("Contains(nil) = true, want false")
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	s, err := New(mustParse(t, "https://www.example.com/"), ModeDomain, []string{"example.com"}, []string{"cdn.example.net"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{"primary host", "https://www.example.com/a?b=c", "https://www.example.com/a?b=c"},
+		{"primary host over http", "http://www.example.com/a", "https://www.example.com/a"},
+		{"alias", "https://example.com/a", "https://www.example.com/a"},
+		{"alias over http", "http://EXAMPLE.com/a", "https://www.example.com/a"},
+		{"subdomain keeps its scheme", "http://blog.example.com/a", "http://blog.example.com/a"},
+		{"allowed host keeps its scheme", "http://cdn.example.net/a", "http://cdn.example.net/a"},
+		{"out of scope", "http://other.example.net/a", "http://other.example.net/a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.Canonical(mustParse(t, tt.url)).String(); got != tt.want {
+				t.Errorf("Canonical(%s) = %s, want %s", tt.url, got, tt.want)
+			}
+		})
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"net/url"
 	"sort"
 	"time"
+
+	"github.com/ncecere/mapper/pkg/scope"
+	"github.com/ncecere/mapper/pkg/urlnorm"
 )
 
 // Builder handles the construction of sitemaps
@@ -17,6 +20,31 @@ type Builder struct {
 
 	// options for sitemap generation
 	options BuilderOptions
+
+	// canonicals maps a URL to the canonical URL it declares
+	canonicals map[string]string
+
+	// canonicalIssues holds problems found while consolidating canonical URLs
+	canonicalIssues []CanonicalIssue
+
+	// inlinks counts the pages linking to each URL
+	inlinks map[string]int
+
+	// images holds the image URLs of each URL
+	images map[string][]string
+}
+
+// CanonicalIssue describes a canonical declaration that needed attention
+// while consolidating the sitemap
+type CanonicalIssue struct {
+	// URL is the crawled URL declaring a canonical
+	URL string
+
+	// Canonical is the canonical URL the declaration resolved to
+	Canonical string
+
+	// Reason describes the issue
+	Reason string
 }
 
 // BuilderOptions configures the sitemap building process
@@ -38,6 +66,26 @@ type BuilderOptions struct {
 
 	// StripQueryParams determines if query parameters should be stripped from URLs
 	StripQueryParams bool
+
+	// Normalizer normalizes URLs before they are added, so equivalent
+	// spellings of a URL are listed once. If nil, URLs are used as given.
+	Normalizer *urlnorm.Normalizer
+
+	// Scope holds the hosts whose URLs may be listed. If nil, only URLs
+	// on the host of the base URL are listed.
+	Scope *scope.Scope
+
+	// Rules assign priorities and change frequencies to matching URLs,
+	// taking precedence over the defaults and AutoPriority
+	Rules *Rules
+
+	// AutoPriority derives the priority of URLs not given one by Rules from
+	// their crawl depth and the number of pages linking to them
+	AutoPriority bool
+
+	// MaxImagesPerURL limits the number of images listed for a URL
+	// (0 for no limit other than the protocol's)
+	MaxImagesPerURL int
 }
 
 // DefaultBuilderOptions returns the default options for sitemap building
@@ -48,30 +96,46 @@ func DefaultBuilderOptions() BuilderOptions {
 		IncludeLastMod:    true,
 		SortByLastMod:     true,
 		StripQueryParams:  true,
+		MaxImagesPerURL:   MaxImagesPerURL,
 	}
 }
 
 // NewBuilder creates a new sitemap builder
 func NewBuilder(baseURL *url.URL, options BuilderOptions) *Builder {
+	baseURL = options.Normalizer.Normalize(baseURL)
+	if options.Scope == nil {
+		options.Scope = scope.Exact(baseURL)
+	}
+
 	return &Builder{
-		baseURL: baseURL,
-		urlset:  NewURLSet(),
-		options: options,
+		baseURL:    baseURL,
+		urlset:     NewURLSet(),
+		options:    options,
+		canonicals: make(map[string]string),
+		inlinks:    make(map[string]int),
+		images:     make(map[string][]string),
 	}
 }
 
 // AddURL adds a URL to the sitemap
 func (b *Builder) AddURL(loc string, lastMod time.Time) error {
+	return b.AddURLAtDepth(loc, lastMod, 0)
+}
+
+// AddURLAtDepth adds a URL found at a crawl depth to the sitemap, for rules
+// and automatic priorities that depend on the depth
+func (b *Builder) AddURLAtDepth(loc string, lastMod time.Time, depth int) error {
 	// Parse the URL to validate it
 	parsedURL, err := url.Parse(loc)
 	if err != nil {
 		return fmt.Errorf("invalid URL %s: %w", loc, err)
 	}
 
-	// Ensure URL is in the same domain as base URL
-	if parsedURL.Host != b.baseURL.Host {
-		return fmt.Errorf("URL %s is not in the same domain as base URL", loc)
+	// Ensure URL is on an in-scope host
+	if !b.options.Scope.Contains(parsedURL) {
+		return fmt.Errorf("URL %s is outside the crawl scope", loc)
 	}
+	parsedURL = b.canonical(parsedURL)
 
 	// Check against excluded paths
 	for _, excludePath := range b.options.ExcludePaths {
@@ -80,20 +144,16 @@ func (b *Builder) AddURL(loc string, lastMod time.Time) error {
 		}
 	}
 
-	// Strip query parameters if configured
-	if b.options.StripQueryParams {
-		parsedURL.RawQuery = ""
-	}
-
 	// Create URL entry
 	url := URL{
-		Loc:        parsedURL.String(),
+		Loc:        b.normalizeLoc(parsedURL),
 		LastModded: lastMod,
+		Depth:      depth,
 	}
 
 	// Add optional fields based on configuration
 	if b.options.IncludeLastMod {
-		url.LastMod = lastMod.Format("2006-01-02")
+		url.LastMod = FormatLastMod(lastMod)
 	}
 
 	if b.options.DefaultChangeFreq != "" {
@@ -101,7 +161,8 @@ func (b *Builder) AddURL(loc string, lastMod time.Time) error {
 	}
 
 	if b.options.DefaultPriority != 0 {
-		url.Priority = b.options.DefaultPriority
+		priority := b.options.DefaultPriority
+		url.Priority = &priority
 	}
 
 	// Add to urlset
@@ -109,8 +170,87 @@ func (b *Builder) AddURL(loc string, lastMod time.Time) error {
 	return nil
 }
 
+// SetCanonical records the canonical URL declared by a URL. When the
+// sitemap is built, only canonical URLs are listed.
+func (b *Builder) SetCanonical(loc, canonical string) error {
+	parsedURL, err := url.Parse(loc)
+	if err != nil {
+		return fmt.Errorf("invalid URL %s: %w", loc, err)
+	}
+
+	canonicalURL, err := url.Parse(canonical)
+	if err != nil {
+		return fmt.Errorf("invalid canonical URL %s: %w", canonical, err)
+	}
+
+	canonicalURL = b.canonical(parsedURL.ResolveReference(canonicalURL))
+	parsedURL = b.canonical(parsedURL)
+
+	b.canonicals[b.normalizeLoc(parsedURL)] = b.normalizeLoc(canonicalURL)
+	return nil
+}
+
+// AddLinks records the links found on a page, counting each linked URL once
+// per page towards the inbound links used by AutoPriority
+func (b *Builder) AddLinks(loc string, links []string) {
+	from := loc
+	if parsedURL, err := url.Parse(loc); err == nil {
+		from = b.normalizeLoc(b.canonical(parsedURL))
+	}
+
+	seen := make(map[string]bool)
+	for _, link := range links {
+		parsedURL, err := url.Parse(link)
+		if err != nil || !b.options.Scope.Contains(parsedURL) {
+			continue
+		}
+		target := b.normalizeLoc(b.canonical(parsedURL))
+		if target != from && !seen[target] {
+			seen[target] = true
+			b.inlinks[target]++
+		}
+	}
+}
+
+// AddImages records the image URLs found on a URL, which are listed with
+// the URL using the image sitemap extension
+func (b *Builder) AddImages(loc string, images []string) error {
+	parsedURL, err := url.Parse(loc)
+	if err != nil {
+		return fmt.Errorf("invalid URL %s: %w", loc, err)
+	}
+	loc = b.normalizeLoc(b.canonical(parsedURL))
+	b.images[loc] = append(b.images[loc], images...)
+	return nil
+}
+
+// canonical normalizes a URL and maps in-scope URLs to their primary host
+func (b *Builder) canonical(u *url.URL) *url.URL {
+	return b.options.Scope.Canonical(b.options.Normalizer.Normalize(u))
+}
+
+// normalizeLoc returns the sitemap location for a normalized URL
+func (b *Builder) normalizeLoc(u *url.URL) string {
+	// Strip query parameters if configured
+	if b.options.StripQueryParams {
+		stripped := *u
+		stripped.RawQuery = ""
+		u = &stripped
+	}
+	return u.String()
+}
+
 // Build finalizes and returns the sitemap
 func (b *Builder) Build() (*URLSet, error) {
+	// List each canonical URL once
+	b.consolidateCanonicals()
+
+	// Assign priorities and change frequencies
+	b.applyRules()
+
+	// List the images of each URL
+	b.attachImages()
+
 	// Sort URLs if configured
 	if b.options.SortByLastMod {
 		sort.Slice(b.urlset.URLs, func(i, j int) bool {
@@ -118,14 +258,229 @@ func (b *Builder) Build() (*URLSet, error) {
 		})
 	}
 
-	// Validate the sitemap
-	if err := b.urlset.Validate(); err != nil {
+	// Validate the sitemap; sets exceeding the per-file limits are split
+	// into a sitemap index by the writer
+	if b.urlset.Size() == 0 {
+		return nil, fmt.Errorf("sitemap validation failed: sitemap must contain at least one URL")
+	}
+	if err := b.urlset.ValidateURLs(); err != nil {
 		return nil, fmt.Errorf("sitemap validation failed: %w", err)
 	}
 
 	return b.urlset, nil
 }
 
+// BuildPerHost finalizes the sitemap like Build and splits it into one
+// sitemap per host, keyed by host
+func (b *Builder) BuildPerHost() (map[string]*URLSet, error) {
+	urlset, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	sets := make(map[string]*URLSet)
+	for _, entry := range urlset.URLs {
+		parsedURL, err := url.Parse(entry.Loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL %s: %w", entry.Loc, err)
+		}
+
+		set, ok := sets[parsedURL.Host]
+		if !ok {
+			set = urlset.cloneEmpty()
+			sets[parsedURL.Host] = set
+		}
+		set.URLs = append(set.URLs, entry)
+	}
+
+	return sets, nil
+}
+
+// consolidateCanonicals replaces URLs by the canonical URL they declare and
+// removes duplicate entries, preferring the entry of the canonical URL itself.
+// URLs are only replaced by canonical URLs that have an entry of their own.
+func (b *Builder) consolidateCanonicals() {
+	b.canonicalIssues = nil
+
+	listed := make(map[string]bool, len(b.urlset.URLs))
+	for _, entry := range b.urlset.URLs {
+		listed[entry.Loc] = true
+	}
+
+	consolidated := make([]URL, 0, len(b.urlset.URLs))
+	positions := make(map[string]int)
+	own := make(map[string]bool)
+	for _, entry := range b.urlset.URLs {
+		original := entry.Loc
+		target, ok := b.resolveCanonical(original, listed)
+		if !ok {
+			continue
+		}
+		entry.Loc = target
+
+		pos, exists := positions[target]
+		if !exists {
+			positions[target] = len(consolidated)
+			own[target] = original == target
+			consolidated = append(consolidated, entry)
+			continue
+		}
+
+		// Keep the canonical URL's own entry, otherwise the most recent one
+		if own[target] {
+			continue
+		}
+		if original == target || consolidated[pos].LastModded.Before(entry.LastModded) {
+			own[target] = original == target
+			consolidated[pos] = entry
+		}
+	}
+
+	b.urlset.URLs = consolidated
+}
+
+// resolveCanonical follows the canonical declarations starting at loc and
+// returns the URL that should be listed instead. It returns false if the
+// URL should not be listed at all, e.g. because its canonical URL is on
+// another host or has no listed entry, such as a noindex or excluded page.
+func (b *Builder) resolveCanonical(loc string, listed map[string]bool) (string, bool) {
+	current := loc
+	visited := map[string]bool{loc: true}
+	hops := 0
+	for {
+		next, ok := b.canonicals[current]
+		if !ok || next == current {
+			break
+		}
+		if visited[next] {
+			b.canonicalIssues = append(b.canonicalIssues, CanonicalIssue{
+				URL:       loc,
+				Canonical: next,
+				Reason:    "canonical loop",
+			})
+			return loc, true
+		}
+		visited[next] = true
+		current = next
+		hops++
+	}
+
+	if hops > 1 {
+		b.canonicalIssues = append(b.canonicalIssues, CanonicalIssue{
+			URL:       loc,
+			Canonical: current,
+			Reason:    fmt.Sprintf("canonical chain of %d hops", hops),
+		})
+	}
+
+	if parsedURL, err := url.Parse(current); err != nil || !b.options.Scope.Contains(parsedURL) {
+		b.canonicalIssues = append(b.canonicalIssues, CanonicalIssue{
+			URL:       loc,
+			Canonical: current,
+			Reason:    "cross-host canonical",
+		})
+		return "", false
+	}
+
+	if !listed[current] {
+		b.canonicalIssues = append(b.canonicalIssues, CanonicalIssue{
+			URL:       loc,
+			Canonical: current,
+			Reason:    "canonical target not crawled",
+		})
+		return "", false
+	}
+
+	return current, true
+}
+
+// attachImages adds the recorded images of each URL to its entry, up to
+// the per-URL limit, and declares the image namespace if any are listed
+func (b *Builder) attachImages() {
+	limit := MaxImagesPerURL
+	if b.options.MaxImagesPerURL > 0 && b.options.MaxImagesPerURL < limit {
+		limit = b.options.MaxImagesPerURL
+	}
+
+	b.urlset.XMLNSImage = ""
+	for i := range b.urlset.URLs {
+		entry := &b.urlset.URLs[i]
+		entry.Images = nil
+
+		seen := make(map[string]bool)
+		for _, image := range b.images[entry.Loc] {
+			if len(entry.Images) >= limit {
+				break
+			}
+			if !seen[image] {
+				seen[image] = true
+				entry.Images = append(entry.Images, Image{Loc: image})
+			}
+		}
+
+		if len(entry.Images) > 0 {
+			b.urlset.XMLNSImage = ImageNamespace
+		}
+	}
+}
+
+// applyRules sets the priority and change frequency of each URL from the
+// rules, falling back to an automatic priority if enabled
+func (b *Builder) applyRules() {
+	if b.options.Rules == nil && !b.options.AutoPriority {
+		return
+	}
+
+	// Links to a URL count towards the canonical URL it declares
+	inlinks := make(map[string]int)
+	maxInlinks := 0
+	for loc, count := range b.inlinks {
+		target := b.canonicalTarget(loc)
+		inlinks[target] += count
+		maxInlinks = max(maxInlinks, inlinks[target])
+	}
+
+	for i := range b.urlset.URLs {
+		entry := &b.urlset.URLs[i]
+		parsedURL, err := url.Parse(entry.Loc)
+		if err != nil {
+			continue
+		}
+
+		priority, changeFreq := b.options.Rules.Match(parsedURL, entry.Depth)
+		switch {
+		case priority != nil:
+			entry.Priority = priority
+		case b.options.AutoPriority:
+			auto := autoPriority(entry.Depth, inlinks[entry.Loc], maxInlinks)
+			entry.Priority = &auto
+		}
+		if changeFreq != "" {
+			entry.ChangeFreq = changeFreq
+		}
+	}
+}
+
+// canonicalTarget follows the canonical declarations starting at loc and
+// returns the last URL of the chain, stopping at loops
+func (b *Builder) canonicalTarget(loc string) string {
+	visited := map[string]bool{loc: true}
+	for {
+		next, ok := b.canonicals[loc]
+		if !ok || visited[next] {
+			return loc
+		}
+		visited[next] = true
+		loc = next
+	}
+}
+
+// CanonicalIssues returns the canonical chains, loops, cross-host canonicals
+// and canonicals to unlisted URLs found by the last call to Build
+func (b *Builder) CanonicalIssues() []CanonicalIssue {
+	return b.canonicalIssues
+}
+
 // SetChangeFreq sets the change frequency for all URLs
 func (b *Builder) SetChangeFreq(freq string) {
 	for i := range b.urlset.URLs {
@@ -136,13 +491,17 @@ func (b *Builder) SetChangeFreq(freq string) {
 // SetPriority sets the priority for all URLs
 func (b *Builder) SetPriority(priority float64) {
 	for i := range b.urlset.URLs {
-		b.urlset.URLs[i].Priority = priority
+		b.urlset.URLs[i].Priority = &priority
 	}
 }
 
 // Clear removes all URLs from the sitemap
 func (b *Builder) Clear() {
 	b.urlset = NewURLSet()
+	b.canonicals = make(map[string]string)
+	b.canonicalIssues = nil
+	b.inlinks = make(map[string]int)
+	b.images = make(map[string][]string)
 }
 
 // Count returns the number of URLs in the sitemap
@@ -0,0 +1,61 @@
+package sitemap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"time"
+)
+
+// SitemapIndex represents the root element of a sitemap index file
+type SitemapIndex struct {
+	XMLName  xml.Name       `xml:"sitemapindex"`
+	XMLNS    string         `xml:"xmlns,attr"`
+	Sitemaps []SitemapEntry `xml:"sitemap"`
+}
+
+// SitemapEntry represents a single sitemap referenced by a sitemap index
+type SitemapEntry struct {
+	XMLName xml.Name `xml:"sitemap"`
+	Loc     string   `xml:"loc"`
+	LastMod string   `xml:"lastmod,omitempty"`
+}
+
+// NewSitemapIndex creates a new SitemapIndex with the standard sitemap namespace
+func NewSitemapIndex() *SitemapIndex {
+	return &SitemapIndex{
+		XMLNS:    "http://www.sitemaps.org/schemas/sitemap/0.9",
+		Sitemaps: make([]SitemapEntry, 0),
+	}
+}
+
+// AddSitemap adds a sitemap reference to the index
+func (si *SitemapIndex) AddSitemap(loc string, lastMod time.Time) {
+	entry := SitemapEntry{Loc: loc}
+	if !lastMod.IsZero() {
+		entry.LastMod = FormatLastMod(lastMod)
+	}
+	si.Sitemaps = append(si.Sitemaps, entry)
+}
+
+// Validate checks if the sitemap index is valid according to the sitemap protocol
+func (si *SitemapIndex) Validate() error {
+	if len(si.Sitemaps) == 0 {
+		return fmt.Errorf("sitemap index must contain at least one sitemap")
+	}
+
+	if len(si.Sitemaps) > MaxURLsPerSitemap {
+		return fmt.Errorf("sitemap index cannot contain more than 50,000 sitemaps")
+	}
+
+	for _, entry := range si.Sitemaps {
+		if entry.Loc == "" {
+			return fmt.Errorf("sitemap location cannot be empty")
+		}
+
+		if len(entry.Loc) > 2048 {
+			return fmt.Errorf("sitemap location cannot exceed 2048 characters: %s", entry.Loc)
+		}
+	}
+
+	return nil
+}
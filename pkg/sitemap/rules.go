@@ -0,0 +1,137 @@
+package sitemap
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+
+	"github.com/ncecere/mapper/pkg/urlpattern"
+)
+
+// Rule assigns a priority and change frequency to the URLs it matches. A
+// rule matches URLs that match its pattern and lie within its depth bounds;
+// conditions that are not set match all URLs.
+type Rule struct {
+	// Pattern is a path glob such as /blog/** or a full-URL regular
+	// expression prefixed with re:
+	Pattern string `mapstructure:"pattern"`
+
+	// MinDepth and MaxDepth bound the crawl depth of matching URLs
+	MinDepth *int `mapstructure:"min_depth"`
+	MaxDepth *int `mapstructure:"max_depth"`
+
+	// Priority is the priority of matching URLs, from 0.0 to 1.0
+	Priority *float64 `mapstructure:"priority"`
+
+	// ChangeFreq is the change frequency of matching URLs
+	ChangeFreq string `mapstructure:"changefreq"`
+}
+
+// Rules is an ordered list of compiled rules
+type Rules struct {
+	rules []compiledRule
+}
+
+// compiledRule is a rule with its pattern compiled
+type compiledRule struct {
+	Rule
+
+	// pattern is the compiled Pattern, or nil if the rule has none
+	pattern *urlpattern.Pattern
+}
+
+// NewRules validates and compiles rules. The error lists every invalid rule.
+func NewRules(rules []Rule) (*Rules, error) {
+	compiled := make([]compiledRule, 0, len(rules))
+	var errs []error
+	for i, rule := range rules {
+		c, err := compileRule(rule)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid rule %d: %w", i+1, err))
+			continue
+		}
+		compiled = append(compiled, c)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return &Rules{rules: compiled}, nil
+}
+
+// compileRule validates a rule and compiles its pattern
+func compileRule(rule Rule) (compiledRule, error) {
+	c := compiledRule{Rule: rule}
+
+	if rule.Priority == nil && rule.ChangeFreq == "" {
+		return c, fmt.Errorf("rule sets neither priority nor changefreq")
+	}
+	if rule.Priority != nil && (*rule.Priority < 0 || *rule.Priority > 1) {
+		return c, fmt.Errorf("priority must be between 0.0 and 1.0: %g", *rule.Priority)
+	}
+	if rule.ChangeFreq != "" && !validChangeFreqs[rule.ChangeFreq] {
+		return c, fmt.Errorf("invalid change frequency: %s", rule.ChangeFreq)
+	}
+	if rule.MinDepth != nil && rule.MaxDepth != nil && *rule.MinDepth > *rule.MaxDepth {
+		return c, fmt.Errorf("min depth %d exceeds max depth %d", *rule.MinDepth, *rule.MaxDepth)
+	}
+
+	if rule.Pattern != "" {
+		pattern, err := urlpattern.Compile(rule.Pattern)
+		if err != nil {
+			return c, fmt.Errorf("invalid pattern %q: %w", rule.Pattern, err)
+		}
+		c.pattern = &pattern
+	}
+	return c, nil
+}
+
+// Match returns the priority and change frequency of a URL at a crawl
+// depth. Each is taken from the first matching rule that sets it; nil and
+// "" are returned if no matching rule does.
+func (r *Rules) Match(u *url.URL, depth int) (*float64, string) {
+	if r == nil {
+		return nil, ""
+	}
+
+	var priority *float64
+	var changeFreq string
+	for _, rule := range r.rules {
+		if !rule.match(u, depth) {
+			continue
+		}
+		if priority == nil {
+			priority = rule.Priority
+		}
+		if changeFreq == "" {
+			changeFreq = rule.ChangeFreq
+		}
+		if priority != nil && changeFreq != "" {
+			break
+		}
+	}
+	return priority, changeFreq
+}
+
+// match reports whether the rule matches a URL at a crawl depth
+func (r compiledRule) match(u *url.URL, depth int) bool {
+	if r.MinDepth != nil && depth < *r.MinDepth {
+		return false
+	}
+	if r.MaxDepth != nil && depth > *r.MaxDepth {
+		return false
+	}
+	return r.pattern == nil || r.pattern.Match(u)
+}
+
+// autoPriority derives a priority from a URL's crawl depth and the number
+// of pages linking to it relative to the most linked URL, so shallow,
+// well-linked pages rank higher. Priorities range from 0.1 to 1.0.
+func autoPriority(depth, inlinks, maxInlinks int) float64 {
+	priority := 1 / float64(depth+1)
+	if maxInlinks > 0 {
+		linkScore := math.Log1p(float64(inlinks)) / math.Log1p(float64(maxInlinks))
+		priority = (priority + linkScore) / 2
+	}
+	return max(math.Round(priority*10)/10, 0.1)
+}
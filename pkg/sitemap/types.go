@@ -7,11 +7,38 @@ import (
 	"time"
 )
 
+const (
+	// MaxURLsPerSitemap is the maximum number of URLs allowed in a single sitemap
+	MaxURLsPerSitemap = 50000
+
+	// MaxSitemapSize is the maximum uncompressed size of a single sitemap in bytes
+	MaxSitemapSize = 50 * 1024 * 1024
+
+	// MaxImagesPerURL is the maximum number of images allowed per URL by
+	// the image sitemap extension
+	MaxImagesPerURL = 1000
+
+	// ImageNamespace is the XML namespace of the image sitemap extension
+	ImageNamespace = "http://www.google.com/schemas/sitemap-image/1.1"
+)
+
 // URLSet represents the root element of a sitemap
 type URLSet struct {
-	XMLName xml.Name `xml:"urlset"`
-	XMLNS   string   `xml:"xmlns,attr"`
-	URLs    []URL    `xml:"url"`
+	XMLName    xml.Name `xml:"urlset"`
+	XMLNS      string   `xml:"xmlns,attr"`
+	XMLNSImage string   `xml:"xmlns:image,attr,omitempty"`
+	URLs       []URL    `xml:"url"`
+}
+
+// validChangeFreqs are the change frequencies defined by the sitemap protocol
+var validChangeFreqs = map[string]bool{
+	"always":  true,
+	"hourly":  true,
+	"daily":   true,
+	"weekly":  true,
+	"monthly": true,
+	"yearly":  true,
+	"never":   true,
 }
 
 // URL represents a single URL entry in the sitemap
@@ -20,8 +47,16 @@ type URL struct {
 	Loc        string    `xml:"loc"`
 	LastMod    string    `xml:"lastmod,omitempty"`
 	ChangeFreq string    `xml:"changefreq,omitempty"`
-	Priority   float64   `xml:"priority,omitempty"`
+	Priority   *float64  `xml:"priority,omitempty"` // nil omits the priority
+	Images     []Image   `xml:"image:image,omitempty"`
 	LastModded time.Time `xml:"-"` // Internal field for sorting
+	Depth      int       `xml:"-"` // Crawl depth, used by priority rules
+}
+
+// Image represents an image of a URL in the image sitemap extension
+type Image struct {
+	XMLName xml.Name `xml:"image:image"`
+	Loc     string   `xml:"image:loc"`
 }
 
 // NewURLSet creates a new URLSet with the standard sitemap namespace
@@ -36,12 +71,23 @@ func NewURLSet() *URLSet {
 func (us *URLSet) AddURL(loc string, lastMod time.Time) {
 	url := URL{
 		Loc:        loc,
-		LastMod:    lastMod.Format("2006-01-02"),
+		LastMod:    FormatLastMod(lastMod),
 		LastModded: lastMod,
 	}
 	us.URLs = append(us.URLs, url)
 }
 
+// FormatLastMod formats a last modification time as a W3C datetime in UTC.
+// Times at midnight UTC, e.g. parsed from a date without a time, are
+// formatted as a date only.
+func FormatLastMod(t time.Time) string {
+	t = t.UTC()
+	if t.Equal(t.Truncate(24 * time.Hour)) {
+		return t.Format("2006-01-02")
+	}
+	return t.Format(time.RFC3339)
+}
+
 // SortByLastMod sorts URLs by last modification date in descending order
 func (us *URLSet) SortByLastMod() {
 	sort.Slice(us.URLs, func(i, j int) bool {
@@ -55,10 +101,16 @@ func (us *URLSet) Validate() error {
 		return fmt.Errorf("sitemap must contain at least one URL")
 	}
 
-	if len(us.URLs) > 50000 {
+	if len(us.URLs) > MaxURLsPerSitemap {
 		return fmt.Errorf("sitemap cannot contain more than 50,000 URLs")
 	}
 
+	return us.ValidateURLs()
+}
+
+// ValidateURLs checks each URL entry against the sitemap protocol without
+// enforcing the per-file limits, which are handled by splitting into an index
+func (us *URLSet) ValidateURLs() error {
 	for _, url := range us.URLs {
 		if url.Loc == "" {
 			return fmt.Errorf("URL location cannot be empty")
@@ -68,21 +120,12 @@ func (us *URLSet) Validate() error {
 			return fmt.Errorf("URL location cannot exceed 2048 characters: %s", url.Loc)
 		}
 
-		if url.Priority != 0 && (url.Priority < 0.0 || url.Priority > 1.0) {
+		if url.Priority != nil && (*url.Priority < 0.0 || *url.Priority > 1.0) {
 			return fmt.Errorf("URL priority must be between 0.0 and 1.0: %s", url.Loc)
 		}
 
 		if url.ChangeFreq != "" {
-			validFreqs := map[string]bool{
-				"always":  true,
-				"hourly":  true,
-				"daily":   true,
-				"weekly":  true,
-				"monthly": true,
-				"yearly":  true,
-				"never":   true,
-			}
-			if !validFreqs[url.ChangeFreq] {
+			if !validChangeFreqs[url.ChangeFreq] {
 				return fmt.Errorf("invalid change frequency for URL %s: %s", url.Loc, url.ChangeFreq)
 			}
 		}
@@ -96,6 +139,24 @@ func (us *URLSet) Size() int {
 	return len(us.URLs)
 }
 
+// latestLastMod returns the most recent modification time of all URLs
+func (us *URLSet) latestLastMod() time.Time {
+	var latest time.Time
+	for _, url := range us.URLs {
+		if url.LastModded.After(latest) {
+			latest = url.LastModded
+		}
+	}
+	return latest
+}
+
+// cloneEmpty creates a URLSet with the same root attributes but no URLs
+func (us *URLSet) cloneEmpty() *URLSet {
+	clone := *us
+	clone.URLs = make([]URL, 0)
+	return &clone
+}
+
 // Clone creates a deep copy of the URLSet
 func (us *URLSet) Clone() *URLSet {
 	clone := NewURLSet()
@@ -1,16 +1,24 @@
 package sitemap
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/xml"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // Writer handles sitemap file generation
 type Writer struct {
 	// Indentation for XML output
 	indent bool
+
+	// gzip compresses all written files and adds a .gz extension
+	gzip bool
 }
 
 // NewWriter creates a new sitemap writer
@@ -20,6 +28,12 @@ func NewWriter(indent bool) *Writer {
 	}
 }
 
+// SetGzip sets whether written files are gzip-compressed.
+// Files whose name ends in .gz are always compressed.
+func (w *Writer) SetGzip(enabled bool) {
+	w.gzip = enabled
+}
+
 // WriteToFile writes the sitemap to a file
 func (w *Writer) WriteToFile(urlset *URLSet, filename string) error {
 	// Validate sitemap before writing
@@ -27,6 +41,167 @@ func (w *Writer) WriteToFile(urlset *URLSet, filename string) error {
 		return fmt.Errorf("invalid sitemap: %w", err)
 	}
 
+	return w.writeXML(urlset, filename)
+}
+
+// WriteIndexToFile writes the sitemap index to a file
+func (w *Writer) WriteIndexToFile(index *SitemapIndex, filename string) error {
+	// Validate sitemap index before writing
+	if err := index.Validate(); err != nil {
+		return fmt.Errorf("invalid sitemap index: %w", err)
+	}
+
+	return w.writeXML(index, filename)
+}
+
+// WriteSitemaps writes the sitemap to filename, splitting it into
+// numbered sitemaps (sitemap-1.xml, sitemap-2.xml, ...) next to filename
+// and writing a sitemap index to filename when the URL set exceeds the
+// protocol limits. The index references each sitemap by its file name
+// resolved against baseURL. It returns the paths of all files written.
+//
+// When gzip output is enabled, the .gz extension is added to filename if
+// missing and all files are compressed. The size limit always applies to
+// the uncompressed XML, as the protocol requires.
+func (w *Writer) WriteSitemaps(urlset *URLSet, filename string, baseURL *url.URL) ([]string, error) {
+	if w.gzip && !isGzipFile(filename) {
+		filename += ".gz"
+	}
+
+	shards, err := w.Split(urlset)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(shards) == 1 {
+		if err := w.WriteToFile(shards[0], filename); err != nil {
+			return nil, err
+		}
+		if err := removeShards(filename, 1); err != nil {
+			return nil, err
+		}
+		return []string{filename}, nil
+	}
+
+	index := NewSitemapIndex()
+	files := make([]string, 0, len(shards)+1)
+	for i, shard := range shards {
+		shardFile := ShardFilename(filename, i+1)
+		if err := w.WriteToFile(shard, shardFile); err != nil {
+			return nil, fmt.Errorf("failed to write sitemap %s: %w", shardFile, err)
+		}
+		files = append(files, shardFile)
+
+		loc := baseURL.ResolveReference(&url.URL{Path: filepath.Base(shardFile)})
+		index.AddSitemap(loc.String(), shard.latestLastMod())
+	}
+
+	if err := w.WriteIndexToFile(index, filename); err != nil {
+		return nil, fmt.Errorf("failed to write sitemap index: %w", err)
+	}
+
+	if err := removeShards(filename, len(shards)+1); err != nil {
+		return nil, err
+	}
+
+	return append([]string{filename}, files...), nil
+}
+
+// removeShards removes the sitemaps of an index written to filename from
+// the n-th on, left over from a previous run that wrote more of them
+func removeShards(filename string, n int) error {
+	for ; ; n++ {
+		shardFile := ShardFilename(filename, n)
+		if err := os.Remove(shardFile); err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return fmt.Errorf("failed to remove stale sitemap %s: %w", shardFile, err)
+		}
+	}
+}
+
+// ShardFilename returns the file name of the n-th sitemap for an index
+// written to filename, e.g. sitemap-2.xml for sitemap.xml and
+// sitemap-2.xml.gz for sitemap.xml.gz
+func ShardFilename(filename string, n int) string {
+	var gz string
+	if isGzipFile(filename) {
+		gz = filepath.Ext(filename)
+		filename = strings.TrimSuffix(filename, gz)
+	}
+
+	ext := filepath.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+	return fmt.Sprintf("%s-%d%s%s", base, n, ext, gz)
+}
+
+// isGzipFile reports whether filename has a gzip extension
+func isGzipFile(filename string) bool {
+	return strings.EqualFold(filepath.Ext(filename), ".gz")
+}
+
+// Split divides a URL set into sets that each satisfy the protocol limits
+// of 50,000 URLs and 50 MB of uncompressed XML. A set that is already
+// within the limits is returned as the only element.
+func (w *Writer) Split(urlset *URLSet) ([]*URLSet, error) {
+	// Size of the XML header and the empty <urlset> element
+	overhead, err := w.encodedSize(urlset.cloneEmpty())
+	if err != nil {
+		return nil, err
+	}
+	overhead += len(xml.Header) + 1
+
+	var (
+		shards []*URLSet
+		shard  = urlset.cloneEmpty()
+		size   = overhead
+	)
+	for _, u := range urlset.URLs {
+		urlSize, err := w.encodedSize(u)
+		if err != nil {
+			return nil, err
+		}
+		if w.indent {
+			// Each entry starts on a new line
+			urlSize++
+		}
+
+		if overhead+urlSize > MaxSitemapSize {
+			return nil, fmt.Errorf("URL entry exceeds the maximum sitemap size: %s", u.Loc)
+		}
+
+		if len(shard.URLs) >= MaxURLsPerSitemap || size+urlSize > MaxSitemapSize {
+			shards = append(shards, shard)
+			shard = urlset.cloneEmpty()
+			size = overhead
+		}
+
+		shard.URLs = append(shard.URLs, u)
+		size += urlSize
+	}
+
+	return append(shards, shard), nil
+}
+
+// encodedSize returns the number of bytes v occupies when encoded one
+// level below the root element
+func (w *Writer) encodedSize(v interface{}) (int, error) {
+	var output []byte
+	var err error
+	if w.indent {
+		output, err = xml.MarshalIndent(v, "  ", "  ")
+	} else {
+		output, err = xml.Marshal(v)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal sitemap: %w", err)
+	}
+	return len(output), nil
+}
+
+// writeXML encodes v as an XML document to a file
+func (w *Writer) writeXML(v interface{}, filename string) error {
 	// Create directory if it doesn't exist
 	dir := filepath.Dir(filename)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -40,23 +215,37 @@ func (w *Writer) WriteToFile(urlset *URLSet, filename string) error {
 	}
 	defer file.Close()
 
+	// Compress output if requested
+	var out io.Writer = file
+	var gz *gzip.Writer
+	if w.gzip || isGzipFile(filename) {
+		gz = gzip.NewWriter(file)
+		out = gz
+	}
+
 	// Create encoder
-	encoder := xml.NewEncoder(file)
+	encoder := xml.NewEncoder(out)
 	if w.indent {
 		encoder.Indent("", "  ")
 	}
 
 	// Write XML header
-	if _, err := file.WriteString(xml.Header); err != nil {
+	if _, err := io.WriteString(out, xml.Header); err != nil {
 		return fmt.Errorf("failed to write XML header: %w", err)
 	}
 
 	// Encode sitemap
-	if err := encoder.Encode(urlset); err != nil {
+	if err := encoder.Encode(v); err != nil {
 		return fmt.Errorf("failed to encode sitemap: %w", err)
 	}
 
-	return nil
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return fmt.Errorf("failed to compress sitemap: %w", err)
+		}
+	}
+
+	return file.Close()
 }
 
 // WriteToString returns the sitemap as a string
@@ -112,7 +301,7 @@ func (w *Writer) Compare(original, new *URLSet) (added, removed []URL) {
 	return added, removed
 }
 
-// ValidateFile checks if an existing sitemap file is valid
+// ValidateFile checks if an existing sitemap or sitemap index file is valid
 func (w *Writer) ValidateFile(filename string) error {
 	// Read file
 	data, err := os.ReadFile(filename)
@@ -120,6 +309,36 @@ func (w *Writer) ValidateFile(filename string) error {
 		return fmt.Errorf("failed to read file: %w", err)
 	}
 
+	// Decompress gzipped sitemaps
+	if isGzipFile(filename) {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("failed to decompress file: %w", err)
+		}
+		defer gz.Close()
+
+		if data, err = io.ReadAll(gz); err != nil {
+			return fmt.Errorf("failed to decompress file: %w", err)
+		}
+	}
+
+	root, err := rootElement(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse sitemap: %w", err)
+	}
+
+	// Sharded sitemaps are written as an index
+	if root == "sitemapindex" {
+		var index SitemapIndex
+		if err := xml.Unmarshal(data, &index); err != nil {
+			return fmt.Errorf("failed to parse sitemap index: %w", err)
+		}
+		if err := index.Validate(); err != nil {
+			return fmt.Errorf("sitemap index validation failed: %w", err)
+		}
+		return nil
+	}
+
 	// Parse XML
 	var urlset URLSet
 	if err := xml.Unmarshal(data, &urlset); err != nil {
@@ -133,3 +352,17 @@ func (w *Writer) ValidateFile(filename string) error {
 
 	return nil
 }
+
+// rootElement returns the local name of the root element of an XML document
+func rootElement(data []byte) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package sitemap
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestURLSet returns a URL set of n URLs whose locations are padded to
+// at least locLen characters
+func newTestURLSet(n, locLen int) *URLSet {
+	urlset := NewURLSet()
+	for i := 0; i < n; i++ {
+		loc := fmt.Sprintf("https://example.com/%d", i)
+		if len(loc) < locLen {
+			loc += "/" + strings.Repeat("a", locLen-len(loc)-1)
+		}
+		urlset.AddURL(loc, time.Time{})
+	}
+	return urlset
+}
+
+func TestSplitShardBoundaries(t *testing.T) {
+	tests := []struct {
+		name   string
+		urls   int
+		locLen int
+		want   []int
+	}{
+		{"empty", 0, 0, []int{0}},
+		{"single URL", 1, 0, []int{1}},
+		{"at the URL limit", MaxURLsPerSitemap, 0, []int{MaxURLsPerSitemap}},
+		{"one over the URL limit", MaxURLsPerSitemap + 1, 0, []int{MaxURLsPerSitemap, 1}},
+		{"twice the URL limit", 2 * MaxURLsPerSitemap, 0, []int{MaxURLsPerSitemap, MaxURLsPerSitemap}},
+		{"twice the URL limit plus one", 2*MaxURLsPerSitemap + 1, 0, []int{MaxURLsPerSitemap, MaxURLsPerSitemap, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shards, err := NewWriter(true).Split(newTestURLSet(tt.urls, tt.locLen))
+			if err != nil {
+				t.Fatalf("Split() error = %v", err)
+			}
+
+			got := make([]int, len(shards))
+			for i, shard := range shards {
+				got[i] = len(shard.URLs)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Split() shard sizes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitSizeLimit(t *testing.T) {
+	for _, indent := range []bool{false, true} {
+		t.Run(fmt.Sprintf("indent=%v", indent), func(t *testing.T) {
+			w := NewWriter(indent)
+			urlset := newTestURLSet(30000, 2000)
+
+			shards, err := w.Split(urlset)
+			if err != nil {
+				t.Fatalf("Split() error = %v", err)
+			}
+			if len(shards) != 2 {
+				t.Fatalf("Split() returned %d shards, want 2", len(shards))
+			}
+
+			total := 0
+			for i, shard := range shards {
+				total += len(shard.URLs)
+
+				// The written file must stay within the size limit
+				filename := filepath.Join(t.TempDir(), "sitemap.xml")
+				if err := w.WriteToFile(shard, filename); err != nil {
+					t.Fatalf("WriteToFile() error = %v", err)
+				}
+				info, err := os.Stat(filename)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Size() > MaxSitemapSize {
+					t.Errorf("shard %d is %d bytes, want at most %d", i+1, info.Size(), MaxSitemapSize)
+				}
+			}
+			if total != len(urlset.URLs) {
+				t.Errorf("shards hold %d URLs, want %d", total, len(urlset.URLs))
+			}
+		})
+	}
+}
+
+func TestWriteSitemapsValidateAndCleanUp(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "sitemap.xml")
+	baseURL, _ := url.Parse("https://example.com/")
+	w := NewWriter(false)
+
+	// A sharded sitemap is written as a valid index
+	files, err := w.WriteSitemaps(newTestURLSet(2*MaxURLsPerSitemap+1, 0), filename, baseURL)
+	if err != nil {
+		t.Fatalf("WriteSitemaps() error = %v", err)
+	}
+	if len(files) != 4 {
+		t.Fatalf("WriteSitemaps() wrote %d files, want 4", len(files))
+	}
+	for _, file := range files {
+		if err := w.ValidateFile(file); err != nil {
+			t.Errorf("ValidateFile(%s) error = %v", filepath.Base(file), err)
+		}
+	}
+
+	// A rerun with fewer shards removes the stale ones
+	if _, err := w.WriteSitemaps(newTestURLSet(MaxURLsPerSitemap+1, 0), filename, baseURL); err != nil {
+		t.Fatalf("WriteSitemaps() error = %v", err)
+	}
+	if _, err := os.Stat(ShardFilename(filename, 3)); !os.IsNotExist(err) {
+		t.Errorf("stale shard 3 was not removed")
+	}
+
+	// An unsharded sitemap removes all shards
+	if _, err := w.WriteSitemaps(newTestURLSet(1, 0), filename, baseURL); err != nil {
+		t.Fatalf("WriteSitemaps() error = %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d files, want only the sitemap", len(entries))
+	}
+	if err := w.ValidateFile(filename); err != nil {
+		t.Errorf("ValidateFile() error = %v", err)
+	}
+}
+
+func TestShardFilename(t *testing.T) {
+	tests := []struct {
+		filename string
+		n        int
+		want     string
+	}{
+		{"sitemap.xml", 1, "sitemap-1.xml"},
+		{"out/sitemap.xml", 12, "out/sitemap-12.xml"},
+		{"sitemap.xml.gz", 2, "sitemap-2.xml.gz"},
+		{"sitemap", 3, "sitemap-3"},
+	}
+
+	for _, tt := range tests {
+		if got := ShardFilename(tt.filename, tt.n); got != tt.want {
+			t.Errorf("ShardFilename(%q, %d) = %q, want %q", tt.filename, tt.n, got, tt.want)
+		}
+	}
+}
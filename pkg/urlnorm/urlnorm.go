@@ -0,0 +1,406 @@
+// Package urlnorm normalizes URLs so that equivalent spellings of the same
+// URL compare equal, e.g. when deduplicating crawled URLs or sitemap entries.
+package urlnorm
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Rule transforms a URL in place as one step of normalization
+type Rule func(u *url.URL)
+
+// Normalizer applies an ordered pipeline of rules to URLs
+type Normalizer struct {
+	rules []Rule
+}
+
+// Trailing slash policies
+const (
+	// TrailingSlashKeep leaves trailing slashes as they are
+	TrailingSlashKeep = "keep"
+
+	// TrailingSlashAdd adds a trailing slash to paths without one
+	TrailingSlashAdd = "add"
+
+	// TrailingSlashRemove removes trailing slashes except from the root path
+	TrailingSlashRemove = "remove"
+)
+
+// Options configures the rules of a Normalizer built by NewFromOptions
+type Options struct {
+	// TrailingSlash is the trailing slash policy: keep, add or remove
+	TrailingSlash string
+
+	// SortQuery sorts query parameters by name
+	SortQuery bool
+
+	// StripTracking removes the query parameters listed in TrackingParams
+	StripTracking bool
+
+	// TrackingParams are the parameter names removed by StripTracking;
+	// a trailing * matches any suffix, e.g. utm_*
+	TrackingParams []string
+
+	// KeepParams, if not empty, is an allow-list of query parameter names;
+	// all other parameters are removed. A trailing * matches any suffix.
+	KeepParams []string
+
+	// DropParams is a deny-list of query parameter names to remove, e.g.
+	// sort or filter parameters of faceted navigation. A trailing * matches
+	// any suffix.
+	DropParams []string
+
+	// FoldIndex removes directory index file names listed in IndexFiles
+	// from the end of paths, e.g. /docs/index.html becomes /docs/
+	FoldIndex bool
+
+	// IndexFiles are the file names removed by FoldIndex
+	IndexFiles []string
+}
+
+// DefaultOptions returns the default normalization options
+func DefaultOptions() Options {
+	return Options{
+		TrailingSlash: TrailingSlashKeep,
+		SortQuery:     true,
+		StripTracking: true,
+		TrackingParams: []string{
+			"utm_*", "gclid", "dclid", "fbclid", "msclkid", "yclid",
+			"mc_cid", "mc_eid", "_ga", "_gl", "igshid",
+		},
+		IndexFiles: []string{
+			"index.html", "index.htm", "index.php", "default.htm",
+			"default.html", "default.aspx",
+		},
+	}
+}
+
+// New creates a Normalizer applying the given rules in order
+func New(rules ...Rule) *Normalizer {
+	return &Normalizer{rules: rules}
+}
+
+// NewFromOptions creates a Normalizer with the standard rules, which
+// lowercase the scheme and host, remove default ports, fragments and empty
+// queries, normalize percent-encoding and resolve dot segments, followed by
+// the optional rules enabled in opts. Tracking parameters are stripped
+// before the DropParams and KeepParams lists are applied.
+func NewFromOptions(opts Options) *Normalizer {
+	rules := []Rule{
+		LowercaseSchemeHost,
+		RemoveDefaultPort,
+		RemoveFragment,
+		RemoveEmptyQuery,
+		NormalizePercentEncoding,
+		ResolveDotSegments,
+	}
+
+	if opts.FoldIndex {
+		rules = append(rules, FoldIndex(opts.IndexFiles))
+	}
+
+	switch opts.TrailingSlash {
+	case TrailingSlashAdd:
+		rules = append(rules, AddTrailingSlash)
+	case TrailingSlashRemove:
+		rules = append(rules, RemoveTrailingSlash)
+	}
+
+	if opts.StripTracking {
+		rules = append(rules, StripParams(opts.TrackingParams))
+	}
+
+	if len(opts.DropParams) > 0 {
+		rules = append(rules, StripParams(opts.DropParams))
+	}
+
+	if len(opts.KeepParams) > 0 {
+		rules = append(rules, KeepOnlyParams(opts.KeepParams))
+	}
+
+	if opts.SortQuery {
+		rules = append(rules, SortQuery)
+	}
+
+	return New(rules...)
+}
+
+// Normalize returns a normalized copy of u. A nil Normalizer returns u unchanged.
+func (n *Normalizer) Normalize(u *url.URL) *url.URL {
+	if n == nil || u == nil {
+		return u
+	}
+
+	normalized := *u
+	if u.User != nil {
+		user := *u.User
+		normalized.User = &user
+	}
+
+	for _, rule := range n.rules {
+		rule(&normalized)
+	}
+
+	return &normalized
+}
+
+// Append returns a copy of n with additional rules applied after its own
+func (n *Normalizer) Append(rules ...Rule) *Normalizer {
+	if n == nil {
+		return New(rules...)
+	}
+	return New(append(append([]Rule{}, n.rules...), rules...)...)
+}
+
+// LowercaseSchemeHost lowercases the scheme and host
+func LowercaseSchemeHost(u *url.URL) {
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+}
+
+// RemoveDefaultPort removes :80 from http and :443 from https URLs
+func RemoveDefaultPort(u *url.URL) {
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		u.Host = strings.TrimSuffix(u.Host, ":"+port)
+	}
+}
+
+// RemoveFragment removes the fragment
+func RemoveFragment(u *url.URL) {
+	u.Fragment = ""
+	u.RawFragment = ""
+}
+
+// RemoveEmptyQuery removes a trailing ? with no query parameters
+func RemoveEmptyQuery(u *url.URL) {
+	if u.RawQuery == "" {
+		u.ForceQuery = false
+	}
+}
+
+// NormalizePercentEncoding decodes percent-encoded unreserved characters
+// and uppercases the hex digits of the remaining escapes in the path and query
+func NormalizePercentEncoding(u *url.URL) {
+	setEscapedPath(u, normalizeEscapes(u.EscapedPath()))
+	u.RawQuery = normalizeEscapes(u.RawQuery)
+}
+
+// ResolveDotSegments removes . and .. segments from the path and ensures
+// URLs with a host have a path of at least /
+func ResolveDotSegments(u *url.URL) {
+	path := u.EscapedPath()
+	if u.Host != "" && path == "" {
+		path = "/"
+	}
+	setEscapedPath(u, removeDotSegments(path))
+}
+
+// AddTrailingSlash adds a trailing slash to paths without one, unless the
+// last segment looks like a file name
+func AddTrailingSlash(u *url.URL) {
+	path := u.EscapedPath()
+	last := path[strings.LastIndex(path, "/")+1:]
+	if !strings.HasSuffix(path, "/") && !strings.Contains(last, ".") {
+		setEscapedPath(u, path+"/")
+	}
+}
+
+// RemoveTrailingSlash removes the trailing slash from paths other than /
+func RemoveTrailingSlash(u *url.URL) {
+	path := u.EscapedPath()
+	if path != "/" && strings.HasSuffix(path, "/") {
+		setEscapedPath(u, strings.TrimRight(path, "/"))
+		if u.Path == "" {
+			setEscapedPath(u, "/")
+		}
+	}
+}
+
+// FoldIndex returns a rule removing the given directory index file names
+// from the end of paths
+func FoldIndex(indexFiles []string) Rule {
+	return func(u *url.URL) {
+		path := u.EscapedPath()
+		for _, name := range indexFiles {
+			if strings.HasSuffix(strings.ToLower(path), "/"+strings.ToLower(name)) {
+				setEscapedPath(u, path[:len(path)-len(name)])
+				return
+			}
+		}
+	}
+}
+
+// StripParams returns a rule removing the named query parameters; a
+// trailing * in a name matches any suffix
+func StripParams(names []string) Rule {
+	return FilterQuery(func(key string) bool {
+		return !MatchParam(names, key)
+	})
+}
+
+// KeepOnlyParams returns a rule removing all query parameters except the
+// named ones; a trailing * in a name matches any suffix
+func KeepOnlyParams(names []string) Rule {
+	return FilterQuery(func(key string) bool {
+		return MatchParam(names, key)
+	})
+}
+
+// FilterQuery returns a rule keeping only the query parameters for which
+// keep returns true, preserving their original encoding and order
+func FilterQuery(keep func(key string) bool) Rule {
+	return func(u *url.URL) {
+		if u.RawQuery == "" {
+			return
+		}
+
+		params := strings.Split(u.RawQuery, "&")
+		kept := params[:0]
+		for _, param := range params {
+			if param == "" {
+				continue
+			}
+			if keep(queryKey(param)) {
+				kept = append(kept, param)
+			}
+		}
+		u.RawQuery = strings.Join(kept, "&")
+		u.ForceQuery = false
+	}
+}
+
+// SortQuery sorts query parameters by name, keeping the relative order of
+// repeated parameters
+func SortQuery(u *url.URL) {
+	if u.RawQuery == "" {
+		u.ForceQuery = false
+		return
+	}
+
+	params := strings.Split(u.RawQuery, "&")
+	sort.SliceStable(params, func(i, j int) bool {
+		return queryKey(params[i]) < queryKey(params[j])
+	})
+	u.RawQuery = strings.Trim(strings.Join(params, "&"), "&")
+}
+
+// MatchParam reports whether a query parameter name matches any of the
+// given names, ignoring case; a trailing * in a name matches any suffix
+func MatchParam(names []string, key string) bool {
+	key = strings.ToLower(key)
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if strings.HasSuffix(name, "*") {
+			if strings.HasPrefix(key, strings.TrimSuffix(name, "*")) {
+				return true
+			}
+		} else if key == name {
+			return true
+		}
+	}
+	return false
+}
+
+// queryKey returns the unescaped name of a raw query parameter
+func queryKey(param string) string {
+	key, _, _ := strings.Cut(param, "=")
+	if unescaped, err := url.QueryUnescape(key); err == nil {
+		return unescaped
+	}
+	return key
+}
+
+// setEscapedPath sets the path of u from its escaped form
+func setEscapedPath(u *url.URL, escaped string) {
+	path, err := url.PathUnescape(escaped)
+	if err != nil {
+		return
+	}
+	u.Path = path
+	u.RawPath = escaped
+}
+
+// normalizeEscapes decodes escapes of unreserved characters and uppercases
+// the hex digits of all other escapes
+func normalizeEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			c := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if isUnreserved(c) {
+				b.WriteByte(c)
+			} else {
+				b.WriteByte('%')
+				b.WriteString(strings.ToUpper(s[i+1 : i+3]))
+			}
+			i += 2
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// removeDotSegments implements the remove_dot_segments algorithm of RFC 3986
+func removeDotSegments(path string) string {
+	if !strings.Contains(path, ".") {
+		return path
+	}
+
+	segments := strings.Split(path, "/")
+	output := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+			if last {
+				output = append(output, "")
+			}
+		case "..":
+			if len(output) > 1 {
+				output = output[:len(output)-1]
+			}
+			if last {
+				output = append(output, "")
+			}
+		default:
+			output = append(output, segment)
+		}
+	}
+
+	result := strings.Join(output, "/")
+	if strings.HasPrefix(path, "/") && !strings.HasPrefix(result, "/") {
+		result = "/" + result
+	}
+	return result
+}
+
+// isUnreserved reports whether c is an unreserved URI character
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+// isHex reports whether c is a hexadecimal digit
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// unhex returns the value of a hexadecimal digit
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
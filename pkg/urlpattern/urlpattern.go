@@ -0,0 +1,137 @@
+// Package urlpattern matches URLs against path globs and regular
+// expressions, e.g. for include and exclude filters.
+package urlpattern
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// regexPrefix marks a pattern as a regular expression matched against the
+// full URL rather than a glob matched against the path
+const regexPrefix = "re:"
+
+// Pattern is a compiled URL pattern
+type Pattern struct {
+	re *regexp.Regexp
+
+	// fullURL is set for regexes, which match the full URL; globs match the path
+	fullURL bool
+}
+
+// CompileAll compiles patterns of a kind, e.g. include or exclude, that is
+// named in errors. The error lists every pattern that failed to compile.
+func CompileAll(kind string, patterns []string) ([]Pattern, error) {
+	compiled := make([]Pattern, 0, len(patterns))
+	var errs []error
+	for _, pattern := range patterns {
+		p, err := Compile(pattern)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s pattern %q: %w", kind, pattern, err))
+			continue
+		}
+		compiled = append(compiled, p)
+	}
+	return compiled, errors.Join(errs...)
+}
+
+// Compile compiles a pattern. Patterns prefixed with re: are regular
+// expressions matched against the full URL; all others are path globs where
+// * matches within a path segment, ** matches across segments and ? matches
+// a single character.
+func Compile(pattern string) (Pattern, error) {
+	if expr, ok := strings.CutPrefix(pattern, regexPrefix); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return Pattern{}, err
+		}
+		return Pattern{re: re, fullURL: true}, nil
+	}
+
+	re, err := globToRegexp(pattern)
+	if err != nil {
+		return Pattern{}, err
+	}
+	return Pattern{re: re}, nil
+}
+
+// globToRegexp converts a path glob into an anchored regular expression.
+// Globs not starting with / or ** are relative to the root path.
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	if glob == "" {
+		return nil, errors.New("empty pattern")
+	}
+	if !strings.HasPrefix(glob, "/") && !strings.HasPrefix(glob, "**") {
+		glob = "/" + glob
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			// A trailing /** also matches the directory itself
+			expr.WriteString("(?:/.*)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**/"):
+			// **/ matches zero or more directories
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+
+	return regexp.Compile(expr.String())
+}
+
+// Match reports whether the pattern matches u
+func (p Pattern) Match(u *url.URL) bool {
+	if p.fullURL {
+		return p.re.MatchString(u.String())
+	}
+
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	return p.re.MatchString(path)
+}
+
+// LoadFile reads patterns from a file, one per line. Blank lines and lines
+// starting with # are ignored.
+func LoadFile(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pattern file: %w", err)
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read pattern file: %w", err)
+	}
+
+	return patterns, nil
+}
@@ -0,0 +1,129 @@
+package urlpattern
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		url     string
+		want    bool
+	}{
+		// Literal paths
+		{"/about", "https://example.com/about", true},
+		{"/about", "https://example.com/about/", false},
+		{"about", "https://example.com/about", true},
+		{"/", "https://example.com", true},
+		{"/a.b", "https://example.com/axb", false},
+		{"/a+b", "https://example.com/a+b", true},
+
+		// * stays within a segment
+		{"/blog/*", "https://example.com/blog/post", true},
+		{"/blog/*", "https://example.com/blog/", true},
+		{"/blog/*", "https://example.com/blog", false},
+		{"/blog/*", "https://example.com/blog/2024/post", false},
+		{"/*.html", "https://example.com/index.html", true},
+		{"/*.html", "https://example.com/a/index.html", false},
+
+		// ? matches one character within a segment
+		{"/p?", "https://example.com/p1", true},
+		{"/p?", "https://example.com/p10", false},
+		{"/p?", "https://example.com/p/", false},
+
+		// Trailing /** matches the directory and everything below it
+		{"/docs/**", "https://example.com/docs", true},
+		{"/docs/**", "https://example.com/docs/", true},
+		{"/docs/**", "https://example.com/docs/a/b/c", true},
+		{"/docs/**", "https://example.com/docs-old/a", false},
+		{"/**", "https://example.com/", true},
+		{"/**", "https://example.com/a/b", true},
+
+		// **/ matches zero or more directories
+		{"**/*.pdf", "https://example.com/a.pdf", true},
+		{"**/*.pdf", "https://example.com/a/b/c.pdf", true},
+		{"**/*.pdf", "https://example.com/a/b/c.pdf.html", false},
+		{"/a/**/b", "https://example.com/a/b", true},
+		{"/a/**/b", "https://example.com/a/x/y/b", true},
+		{"/a/**/b", "https://example.com/a/xb", false},
+		{"/a/**/b", "https://example.com/a/x/b/c", false},
+
+		// ** elsewhere matches anything
+		{"/a**", "https://example.com/a/b/c", true},
+		{"/a**z", "https://example.com/a/b/z", true},
+		{"**", "https://example.com/anything/at/all", true},
+
+		// Globs match the path only
+		{"/search", "https://example.com/search?q=a", true},
+		{"/search*", "https://other.example/search", true},
+
+		// Regexes match the full URL
+		{"re:[?&]session=", "https://example.com/a?session=1", true},
+		{"re:[?&]session=", "https://example.com/a?x=1", false},
+		{"re:^https://example\\.com/blog/", "https://example.com/blog/a", true},
+		{"re:^https://example\\.com/blog/", "http://example.com/blog/a", false},
+		{"re:/admin/.*", "https://example.com/x/admin/y", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.url, func(t *testing.T) {
+			p, err := Compile(tt.pattern)
+			if err != nil {
+				t.Fatalf("Compile(%q) error = %v", tt.pattern, err)
+			}
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := p.Match(u); got != tt.want {
+				t.Errorf("Compile(%q).Match(%s) = %v, want %v", tt.pattern, tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, pattern := range []string{"", "re:(", "re:[a-"} {
+		if _, err := Compile(pattern); err == nil {
+			t.Errorf("Compile(%q) succeeded, want an error", pattern)
+		}
+	}
+
+	compiled, err := CompileAll("exclude", []string{"/a", "re:(", "/b", ""})
+	if err == nil {
+		t.Fatal("CompileAll() succeeded, want an error")
+	}
+	if len(compiled) != 2 {
+		t.Errorf("CompileAll() compiled %d patterns, want 2", len(compiled))
+	}
+	for _, want := range []string{`invalid exclude pattern "re:("`, `invalid exclude pattern ""`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("CompileAll() error = %q, want it to contain %q", err, want)
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "patterns.txt")
+	content := "# admin pages\n/admin/**\n\n  **/*.pdf  \n  # indented comment\nre:[?&]id=\n"
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	patterns, err := LoadFile(filename)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	want := []string{"/admin/**", "**/*.pdf", "re:[?&]id="}
+	if strings.Join(patterns, "\n") != strings.Join(want, "\n") {
+		t.Errorf("LoadFile() = %q, want %q", patterns, want)
+	}
+
+	if _, err := LoadFile(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("LoadFile() of a missing file succeeded, want an error")
+	}
+}